@@ -0,0 +1,56 @@
+package connector
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"time"
+)
+
+const (
+	acceptMinBackoff = 5 * time.Millisecond
+	acceptMaxBackoff = time.Second
+)
+
+func isTemporaryAcceptError(err error) bool {
+	// Errors that say we're short of something, or that one client
+	// went away before we got to it, rather than that the listening
+	// socket is broken.
+	if errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE) ||
+		errors.Is(err, syscall.ENOBUFS) || errors.Is(err, syscall.ENOMEM) ||
+		errors.Is(err, syscall.ECONNABORTED) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Spaces out retries after temporary accept errors, so that running
+// out of file descriptors doesn't turn into a busy loop.
+type acceptBackoff struct {
+	delay time.Duration
+}
+
+func (backoff *acceptBackoff) wait(done chan struct{}) bool {
+	// Returns false if done was closed while we waited.
+	if backoff.delay == 0 {
+		backoff.delay = acceptMinBackoff
+	} else {
+		backoff.delay *= 2
+	}
+	if backoff.delay > acceptMaxBackoff {
+		backoff.delay = acceptMaxBackoff
+	}
+
+	timer := time.NewTimer(backoff.delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+func (backoff *acceptBackoff) reset() { backoff.delay = 0 }
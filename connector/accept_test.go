@@ -0,0 +1,125 @@
+package connector
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A listener whose Accept() returns whatever the test sends it
+type acceptTestListener struct {
+	conns  chan net.Conn
+	errs   chan error
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (l *acceptTestListener) Addr() net.Addr { return &net.TCPAddr{} }
+
+func (l *acceptTestListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *acceptTestListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func acceptTestListen() (tcpListen, *acceptTestListener) {
+	l := &acceptTestListener{}
+	l.conns = make(chan net.Conn)
+	l.errs = make(chan error)
+	l.closed = make(chan struct{})
+
+	listen := tcpListen{}
+	listen.listener = l
+	listen.id = "0-TEST"
+	listen.fillDefaults()
+	go listen.doListen()
+
+	return listen, l
+}
+
+func TestAcceptErrors(t *testing.T) {
+	t.Parallel()
+
+	listen, l := acceptTestListen()
+
+	emfile := &net.OpError{Op: "accept", Err: os.NewSyscallError("accept4", syscall.EMFILE)}
+	l.errs <- emfile
+	m := <-listen.Notify()
+	assert.Equal(t, ErrorMessage{Err: emfile}, m, "Temporary error reported")
+
+	// Still accepting after the pause
+	client, server := net.Pipe()
+	defer client.Close()
+	l.conns <- server
+	m = <-listen.Notify()
+	assert.IsType(t, NewConnectionMessage{}, m, "Connection after temporary error")
+	close(m.(NewConnectionMessage).Conn.ToConn())
+
+	broken := errors.New("listener broken")
+	l.errs <- broken
+	m = <-listen.Notify()
+	assert.Equal(t, ErrorMessage{Err: broken}, m, "Permanent error reported")
+	m = <-listen.Notify()
+	assert.True(t, m.(ListenerStatusMessage).Closed, "Final status sent")
+
+	select {
+	case m = <-listen.Notify():
+		t.Errorf("Message after final status: %s", m.TypeString())
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestAcceptClose(t *testing.T) {
+	t.Parallel()
+
+	listen, _ := acceptTestListen()
+
+	// Closing on purpose isn't an error
+	status := controlTestStatus(t, listen, CloseListenerMessage{})
+	assert.True(t, status.Closed, "Final status sent")
+
+	select {
+	case m := <-listen.Notify():
+		t.Errorf("Message after final status: %s", m.TypeString())
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestAcceptBackoff(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, isTemporaryAcceptError(os.NewSyscallError("accept4", syscall.EMFILE)), "EMFILE is temporary")
+	assert.True(t, isTemporaryAcceptError(syscall.ECONNABORTED), "ECONNABORTED is temporary")
+	assert.False(t, isTemporaryAcceptError(net.ErrClosed), "Closed listener is permanent")
+
+	backoff := acceptBackoff{}
+	assert.True(t, backoff.wait(nil), "Wait finishes")
+	assert.Equal(t, acceptMinBackoff, backoff.delay, "First wait is the shortest")
+	assert.True(t, backoff.wait(nil), "Wait finishes")
+	assert.Equal(t, 2*acceptMinBackoff, backoff.delay, "Waits get longer")
+
+	done := make(chan struct{})
+	close(done)
+	backoff.delay = acceptMaxBackoff
+	assert.False(t, backoff.wait(done), "Wait interrupted")
+	assert.Equal(t, acceptMaxBackoff, backoff.delay, "Waits are limited")
+
+	backoff.reset()
+	assert.Equal(t, time.Duration(0), backoff.delay, "Reset")
+}
@@ -0,0 +1,55 @@
+package connector
+
+import "sync"
+
+// Things learned about the far end of a Connection, such as a telnet
+// client's terminal type.  Connections are passed around by value, so
+// they share a pointer to this.
+type ConnAttributes struct {
+	mutex  sync.Mutex
+	values map[string]string
+}
+
+func ConnectionAttributes(conn Connection) (*ConnAttributes, bool) {
+	// Finds the attributes recorded by conn, or by whatever it wraps
+	attributed, ok := conn.(AttributeConnection)
+	if !ok || attributed.Attributes() == nil {
+		return nil, false
+	}
+	return attributed.Attributes(), true
+}
+
+func newConnAttributes() *ConnAttributes {
+	attributes := ConnAttributes{}
+	attributes.values = make(map[string]string)
+	return &attributes
+}
+
+func (attributes *ConnAttributes) Get(name string) (string, bool) {
+	attributes.mutex.Lock()
+	defer attributes.mutex.Unlock()
+	value, ok := attributes.values[name]
+	return value, ok
+}
+
+func (attributes *ConnAttributes) All() map[string]string {
+	attributes.mutex.Lock()
+	defer attributes.mutex.Unlock()
+	all := make(map[string]string)
+	for name, value := range attributes.values {
+		all[name] = value
+	}
+	return all
+}
+
+func (attributes *ConnAttributes) set(name string, value string) {
+	attributes.mutex.Lock()
+	defer attributes.mutex.Unlock()
+	attributes.values[name] = value
+}
+
+func (attributes *ConnAttributes) unset(name string) {
+	attributes.mutex.Lock()
+	defer attributes.mutex.Unlock()
+	delete(attributes.values, name)
+}
@@ -1,5 +1,8 @@
 package connector
 
+// Connectors report problems on Notify() with an ErrorMessage.  One
+// that stops for good, whether asked to or not, sends a final
+// ListenerStatusMessage with Closed set and then nothing more.
 type Connector interface {
 	Id() string
 	Control() chan message
@@ -12,6 +15,13 @@ type Connection interface {
 	ToConn() chan message
 }
 
+// Connections that record what they learn about the far end.
+// Filters pass on the attributes of the connection they wrap.
+type AttributeConnection interface {
+	Connection
+	Attributes() *ConnAttributes // Nil if nothing is recorded
+}
+
 type App interface {
 	Id() string
 }
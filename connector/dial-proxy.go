@@ -0,0 +1,242 @@
+package connector
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type DialProxyType int
+
+const (
+	DialProxyNone DialProxyType = iota
+	DialProxySocks5
+	DialProxyHttpConnect
+)
+
+type DialProxy struct {
+	Type     DialProxyType
+	Addr     string // host:port of the proxy
+	Username string // Leave empty if the proxy doesn't need auth
+	Password string
+}
+
+// SOCKS5 constants (RFC 1928 and RFC 1929)
+const (
+	socksVersion        byte = 5
+	socksAuthNone       byte = 0
+	socksAuthPassword   byte = 2
+	socksCommandConnect byte = 1
+	socksAddrIPv4       byte = 1
+	socksAddrDomain     byte = 3
+	socksAddrIPv6       byte = 4
+)
+
+var socksReplies = map[byte]string{
+	1: "general SOCKS server failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// A connection that may have data buffered from the proxy's reply
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) { return c.reader.Read(b) }
+
+func dialTcp(addr string, proxy DialProxy, timeout time.Duration) (net.Conn, error) {
+	if proxy.Type == DialProxyNone {
+		return net.DialTimeout("tcp", addr, timeout)
+	}
+
+	conn, err := net.DialTimeout("tcp", proxy.Addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// The timeout covers talking to the proxy as well
+	conn.SetDeadline(time.Now().Add(timeout))
+	switch proxy.Type {
+	case DialProxySocks5:
+		err = socksConnect(conn, addr, proxy)
+	case DialProxyHttpConnect:
+		conn, err = httpConnect(conn, addr, proxy)
+	default:
+		err = errors.New("unknown proxy type")
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	return conn, nil
+}
+
+func socksConnect(conn net.Conn, addr string, proxy DialProxy) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return err
+	}
+
+	// Offer the authentication methods we can do
+	methods := []byte{socksAuthNone}
+	if proxy.Username != "" {
+		methods = append(methods, socksAuthPassword)
+	}
+	_, err = conn.Write(append([]byte{socksVersion, byte(len(methods))}, methods...))
+	if err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	_, err = io.ReadFull(conn, reply)
+	if err != nil {
+		return err
+	}
+	if reply[0] != socksVersion {
+		return errors.New("proxy is not a SOCKS5 server")
+	}
+
+	switch reply[1] {
+	case socksAuthNone:
+	case socksAuthPassword:
+		err = socksAuthenticate(conn, proxy)
+		if err != nil {
+			return err
+		}
+	default:
+		return errors.New("SOCKS5 proxy requires unsupported authentication")
+	}
+
+	req := []byte{socksVersion, socksCommandConnect, 0}
+	ip := net.ParseIP(host)
+	if ip4 := ip.To4(); ip4 != nil {
+		req = append(req, socksAddrIPv4)
+		req = append(req, ip4...)
+	} else if ip != nil {
+		req = append(req, socksAddrIPv6)
+		req = append(req, ip...)
+	} else {
+		if len(host) > 255 {
+			return errors.New("host name too long for SOCKS5")
+		}
+		req = append(req, socksAddrDomain, byte(len(host)))
+		req = append(req, []byte(host)...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	_, err = conn.Write(req)
+	if err != nil {
+		return err
+	}
+
+	// The reply ends with the address the proxy bound to, which
+	// we read and throw away.
+	reply = make([]byte, 4)
+	_, err = io.ReadFull(conn, reply)
+	if err != nil {
+		return err
+	}
+	if reply[1] != 0 {
+		reason, ok := socksReplies[reply[1]]
+		if !ok {
+			reason = "unknown error " + strconv.Itoa(int(reply[1]))
+		}
+		return errors.New("SOCKS5 proxy: " + reason)
+	}
+
+	addrLen := 0
+	switch reply[3] {
+	case socksAddrIPv4:
+		addrLen = 4
+	case socksAddrIPv6:
+		addrLen = 16
+	case socksAddrDomain:
+		l := make([]byte, 1)
+		_, err = io.ReadFull(conn, l)
+		if err != nil {
+			return err
+		}
+		addrLen = int(l[0])
+	default:
+		return errors.New("SOCKS5 proxy sent unknown address type")
+	}
+	_, err = io.ReadFull(conn, make([]byte, addrLen+2))
+	return err
+}
+
+func socksAuthenticate(conn net.Conn, proxy DialProxy) error {
+	if len(proxy.Username) > 255 || len(proxy.Password) > 255 {
+		return errors.New("SOCKS5 username or password too long")
+	}
+
+	req := []byte{1, byte(len(proxy.Username))}
+	req = append(req, []byte(proxy.Username)...)
+	req = append(req, byte(len(proxy.Password)))
+	req = append(req, []byte(proxy.Password)...)
+	_, err := conn.Write(req)
+	if err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	_, err = io.ReadFull(conn, reply)
+	if err != nil {
+		return err
+	}
+	if reply[1] != 0 {
+		return errors.New("SOCKS5 proxy rejected username or password")
+	}
+	return nil
+}
+
+func httpConnect(conn net.Conn, addr string, proxy DialProxy) (net.Conn, error) {
+	req, err := http.NewRequest(http.MethodConnect, "http://"+addr, nil)
+	if err != nil {
+		return conn, err
+	}
+	req.Host = addr
+	if proxy.Username != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(proxy.Username + ":" + proxy.Password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+
+	err = req.Write(conn)
+	if err != nil {
+		return conn, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return conn, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return conn, errors.New("HTTP proxy: " + resp.Status)
+	}
+
+	// The far end may have spoken before we got here, such as
+	// with a login banner.
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
@@ -0,0 +1,201 @@
+package connector
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Stand-in proxies that connect everything to target, and report the
+// address they were asked for on requested.
+
+func proxyTestRelay(client net.Conn, target string) {
+	server, err := net.Dial("tcp", target)
+	if err != nil {
+		client.Close()
+		return
+	}
+	go func() {
+		io.Copy(server, client)
+		server.Close()
+	}()
+	io.Copy(client, server)
+	client.Close()
+}
+
+func proxyTestSocks5(t *testing.T, user string, password string, target string, requested chan string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, nil, err, "Proxy listen does not return error")
+
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		b := make([]byte, 2)
+		io.ReadFull(conn, b)
+		methods := make([]byte, b[1])
+		io.ReadFull(conn, methods)
+		conn.Write([]byte{5, 2})
+
+		// Username and password
+		io.ReadFull(conn, b)
+		u := make([]byte, b[1])
+		io.ReadFull(conn, u)
+		io.ReadFull(conn, b[:1])
+		p := make([]byte, b[0])
+		io.ReadFull(conn, p)
+		if string(u) != user || string(p) != password {
+			conn.Write([]byte{1, 1})
+			conn.Close()
+			return
+		}
+		conn.Write([]byte{1, 0})
+
+		req := make([]byte, 5)
+		io.ReadFull(conn, req)
+		host := make([]byte, req[4])
+		io.ReadFull(conn, host)
+		io.ReadFull(conn, b)
+		requested <- string(host) + ":" + strconv.Itoa(int(binary.BigEndian.Uint16(b)))
+
+		conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+		proxyTestRelay(conn, target)
+	}()
+
+	return l.Addr().String()
+}
+
+func proxyTestHttp(t *testing.T, auth string, target string, requested chan string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, nil, err, "Proxy listen does not return error")
+
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil || req.Method != http.MethodConnect {
+			conn.Close()
+			return
+		}
+		requested <- req.Host
+		if req.Header.Get("Proxy-Authorization") != "Basic "+auth {
+			conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+			conn.Close()
+			return
+		}
+
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		proxyTestRelay(conn, target)
+	}()
+
+	return l.Addr().String()
+}
+
+func proxyTestTarget(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, nil, err, "Listen does not return error")
+	return l
+}
+
+func proxyTestExchange(t *testing.T, l net.Listener, dial tcpDial) {
+	server, err := l.Accept()
+	assert.Equal(t, nil, err, "Accept does not return error")
+	defer server.Close()
+
+	server.Write([]byte("Hello"))
+	m := <-dial.FromConn()
+	assert.Equal(t, "Hello", m.(DataMessage).String(), "Data through proxy")
+
+	dial.ToConn() <- NewDataMessageFromString("Foo")
+	b := make([]byte, 3)
+	_, err = io.ReadFull(server, b)
+	assert.Equal(t, nil, err, "Server read has no error")
+	assert.Equal(t, "Foo", string(b), "Data through proxy to server")
+
+	close(dial.ToConn())
+	drainMessages(dial.FromConn())
+}
+
+func TestDialProxySocks5(t *testing.T) {
+	t.Parallel()
+
+	l := proxyTestTarget(t)
+	defer l.Close()
+
+	requested := make(chan string, 1)
+	opts := TcpDialOptions{}
+	opts.Proxy = DialProxy{
+		Type:     DialProxySocks5,
+		Addr:     proxyTestSocks5(t, "joel", "secret", l.Addr().String(), requested),
+		Username: "joel",
+		Password: "secret",
+	}
+	dial, err := NewTcpDial("0", "console.example:2001", opts)
+	assert.Equal(t, nil, err, "Dial through proxy does not return error")
+	assert.Equal(t, "console.example:2001", <-requested, "Proxy asked for destination")
+
+	proxyTestExchange(t, l, dial)
+}
+
+func TestDialProxySocks5BadPassword(t *testing.T) {
+	t.Parallel()
+
+	opts := TcpDialOptions{}
+	opts.Proxy = DialProxy{
+		Type:     DialProxySocks5,
+		Addr:     proxyTestSocks5(t, "joel", "secret", "127.0.0.1:1", nil),
+		Username: "joel",
+		Password: "wrong",
+	}
+	_, err := NewTcpDial("0", "console.example:2001", opts)
+	assert.NotEqual(t, nil, err, "Rejected password returns error")
+}
+
+func TestDialProxyHttp(t *testing.T) {
+	t.Parallel()
+
+	l := proxyTestTarget(t)
+	defer l.Close()
+
+	requested := make(chan string, 1)
+	auth := base64.StdEncoding.EncodeToString([]byte("joel:secret"))
+	opts := TcpDialOptions{}
+	opts.Proxy = DialProxy{
+		Type:     DialProxyHttpConnect,
+		Addr:     proxyTestHttp(t, auth, l.Addr().String(), requested),
+		Username: "joel",
+		Password: "secret",
+	}
+	dial, err := NewTcpDial("0", "console.example:2001", opts)
+	assert.Equal(t, nil, err, "Dial through proxy does not return error")
+	assert.Equal(t, "console.example:2001", <-requested, "Proxy asked for destination")
+
+	proxyTestExchange(t, l, dial)
+}
+
+func TestDialProxyHttpRefused(t *testing.T) {
+	t.Parallel()
+
+	requested := make(chan string, 1)
+	opts := TcpDialOptions{}
+	opts.Proxy = DialProxy{
+		Type: DialProxyHttpConnect,
+		Addr: proxyTestHttp(t, "nothing", "127.0.0.1:1", requested),
+	}
+	_, err := NewTcpDial("0", "console.example:2001", opts)
+	assert.NotEqual(t, nil, err, "Refused CONNECT returns error")
+}
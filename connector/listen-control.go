@@ -0,0 +1,224 @@
+package connector
+
+import (
+	"errors"
+	"log"
+	"net"
+	"sync"
+)
+
+// The part of a listener that control messages act on.  Listeners
+// embed this and run acceptLoop, which answers Control() between
+// connections.
+type listenControl struct {
+	id       string
+	listener net.Listener
+	tracker  *connTracker
+	ready    chan net.Conn // Connections done with handshakes, if any
+	done     chan struct{} // Closed when we stop listening
+	control  chan message
+	notify   chan message
+
+	// Only touched by the acceptLoop goroutine
+	paused         bool
+	closed         bool
+	maxConnections int
+}
+
+func (listen *listenControl) fillControlDefaults() {
+	listen.tracker = newConnTracker()
+	listen.done = make(chan struct{})
+	listen.control = make(chan message)
+	listen.notify = make(chan message)
+}
+
+// Keeps track of a listener's open connections so we can count them
+// and, if asked, close them all.
+type connTracker struct {
+	mutex sync.Mutex
+	conns map[net.Conn]bool
+}
+
+func newConnTracker() *connTracker {
+	tracker := connTracker{}
+	tracker.conns = make(map[net.Conn]bool)
+	return &tracker
+}
+
+func (tracker *connTracker) add(conn net.Conn) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	tracker.conns[conn] = true
+}
+
+func (tracker *connTracker) remove(conn net.Conn) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	delete(tracker.conns, conn)
+}
+
+func (tracker *connTracker) count() int {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	return len(tracker.conns)
+}
+
+func (tracker *connTracker) closeAll() {
+	// The connections remove themselves once their handlers notice
+	// the socket is gone, or as they close if they're tracked conns.
+	tracker.mutex.Lock()
+	conns := make([]net.Conn, 0, len(tracker.conns))
+	for conn := range tracker.conns {
+		conns = append(conns, conn)
+	}
+	tracker.mutex.Unlock()
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+// A connection that leaves its tracker when closed, for listeners
+// that hand sockets to code that knows nothing of trackers.
+type trackedConn struct {
+	net.Conn
+	tracker *connTracker
+}
+
+func (c *trackedConn) Close() error {
+	c.tracker.remove(c)
+	return c.Conn.Close()
+}
+
+func (listen *listenControl) track(conn net.Conn) net.Conn {
+	c := &trackedConn{Conn: conn, tracker: listen.tracker}
+	listen.tracker.add(c)
+	return c
+}
+
+func (listen *listenControl) overLimit(conn net.Conn) bool {
+	// Drops conn if we already have as many connections as allowed
+	if listen.maxConnections > 0 && listen.tracker.count() >= listen.maxConnections {
+		log.Print("Too many connections, dropping " + conn.RemoteAddr().String())
+		conn.Close()
+		return true
+	}
+	return false
+}
+
+func (listen *listenControl) acceptLoop(dispatch func(net.Conn), start func(net.Conn)) {
+	// Runs until we stop listening.  New connections go to dispatch,
+	// and any that come back through ready once their handshake is
+	// done go to start.
+	accepted := make(chan net.Conn)
+	failed := make(chan error)
+	go listen.acceptConnections(accepted, failed)
+
+	for !listen.closed {
+		// While paused we leave new connections waiting in the
+		// kernel's backlog.
+		in := accepted
+		if listen.paused {
+			in = nil
+		}
+
+		select {
+		case conn, ok := <-in:
+			if !ok {
+				listen.stop(false)
+				return
+			}
+			dispatch(conn)
+		case err := <-failed:
+			listen.notify <- ErrorMessage{Err: err}
+			if !isTemporaryAcceptError(err) {
+				listen.stop(false)
+				return
+			}
+		case conn := <-listen.ready:
+			start(conn)
+		case m := <-listen.control:
+			listen.processControl(m)
+		}
+	}
+}
+
+func (listen *listenControl) acceptConnections(accepted chan net.Conn, failed chan error) {
+	// Errors go to failed.  Temporary ones, such as running out of
+	// file descriptors, are retried after a pause.  Anything else
+	// ends the loop, closing accepted.
+	defer close(accepted)
+
+	backoff := acceptBackoff{}
+	for {
+		conn, err := listen.listener.Accept()
+		if err != nil {
+			select {
+			case failed <- err:
+			case <-listen.done:
+				// We were closed on purpose
+				return
+			}
+			if !isTemporaryAcceptError(err) || !backoff.wait(listen.done) {
+				return
+			}
+			continue
+		}
+		backoff.reset()
+
+		select {
+		case accepted <- conn:
+		case <-listen.done:
+			conn.Close()
+			return
+		}
+	}
+}
+
+func (listen *listenControl) processControl(m message) {
+	switch m.(type) {
+	case PauseAcceptMessage:
+		listen.paused = true
+	case ResumeAcceptMessage:
+		listen.paused = false
+	case SetMaxConnectionsMessage:
+		listen.maxConnections = m.(SetMaxConnectionsMessage).Max
+	case StatusRequestMessage:
+	case StopAcceptMessage:
+		listen.stop(false)
+		return
+	case CloseListenerMessage:
+		listen.stop(true)
+		return
+	default:
+		listen.notify <- ErrorMessage{Err: errors.New("unknown control message type: " + m.TypeString())}
+		return
+	}
+
+	listen.notify <- listen.status()
+}
+
+func (listen *listenControl) stop(dropConnections bool) {
+	listen.closed = true
+	close(listen.done)
+	listen.listener.Close()
+	if dropConnections {
+		listen.tracker.closeAll()
+	}
+
+	// Nobody reads Control() from now on, so don't leave anyone
+	// stuck sending to it.
+	go drainMessages(listen.control)
+
+	listen.notify <- listen.status()
+}
+
+func (listen *listenControl) status() ListenerStatusMessage {
+	status := ListenerStatusMessage{}
+	status.Id = listen.id
+	status.Accepting = !listen.paused && !listen.closed
+	status.Closed = listen.closed
+	status.Connections = listen.tracker.count()
+	status.MaxConnections = listen.maxConnections
+	return status
+}
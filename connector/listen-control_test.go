@@ -0,0 +1,171 @@
+package connector
+
+import (
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func controlTestStatus(t *testing.T, listen Connector, m message) ListenerStatusMessage {
+	listen.Control() <- m
+	status := <-listen.Notify()
+	assert.IsType(t, ListenerStatusMessage{}, status, "Status reply for "+m.TypeString())
+	return status.(ListenerStatusMessage)
+}
+
+func TestListenControl(t *testing.T) {
+	t.Parallel()
+
+	listen, err := NewTcpListen("0", "127.0.0.1:0")
+	assert.Equal(t, nil, err, "Listener does not return error")
+	addr := listen.Addr.String()
+
+	status := controlTestStatus(t, listen, StatusRequestMessage{})
+	expected := ListenerStatusMessage{Id: listen.Id(), Accepting: true}
+	assert.Equal(t, expected, status, "Initial status")
+
+	first, err := net.Dial("tcp", addr)
+	assert.Equal(t, nil, err, "Error from net.Dial()")
+	defer first.Close()
+	m := <-listen.Notify()
+	conn := m.(NewConnectionMessage).Conn
+
+	status = controlTestStatus(t, listen, SetMaxConnectionsMessage{Max: 1})
+	assert.Equal(t, 1, status.Connections, "One connection")
+	assert.Equal(t, 1, status.MaxConnections, "Maximum set")
+
+	// Over the limit, so dropped
+	second, err := net.Dial("tcp", addr)
+	assert.Equal(t, nil, err, "Error from net.Dial()")
+	b := make([]byte, 1)
+	_, err = second.Read(b)
+	assert.NotEqual(t, nil, err, "Connection over limit closed")
+	second.Close()
+
+	controlTestStatus(t, listen, SetMaxConnectionsMessage{Max: 0})
+	status = controlTestStatus(t, listen, PauseAcceptMessage{})
+	assert.False(t, status.Accepting, "Paused")
+
+	third, err := net.Dial("tcp", addr)
+	assert.Equal(t, nil, err, "Connection waits in backlog while paused")
+	defer third.Close()
+	select {
+	case m = <-listen.Notify():
+		t.Errorf("Connection accepted while paused: %s", m.TypeString())
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	listen.Control() <- ResumeAcceptMessage{}
+	for i := 0; i < 2; i++ {
+		// The status reply and the waiting connection may come
+		// in either order.
+		m = <-listen.Notify()
+		switch m.(type) {
+		case ListenerStatusMessage:
+			assert.True(t, m.(ListenerStatusMessage).Accepting, "Resumed")
+		case NewConnectionMessage:
+			close(m.(NewConnectionMessage).Conn.ToConn())
+		default:
+			t.Errorf("Unexpected message: %s", m.TypeString())
+		}
+	}
+
+	status = controlTestStatus(t, listen, CloseListenerMessage{})
+	assert.True(t, status.Closed, "Closed")
+	assert.False(t, status.Accepting, "Not accepting once closed")
+
+	m = <-conn.FromConn()
+	assert.NotEqual(t, MTDataMessage, m.Type(), "Existing connection dropped")
+	close(conn.ToConn())
+
+	_, err = net.Dial("tcp", addr)
+	assert.NotEqual(t, nil, err, "Listening socket closed")
+}
+
+func TestListenControlStop(t *testing.T) {
+	t.Parallel()
+
+	listen, err := NewTcpListen("0", "127.0.0.1:0")
+	assert.Equal(t, nil, err, "Listener does not return error")
+	addr := listen.Addr.String()
+
+	outbound, err := net.Dial("tcp", addr)
+	assert.Equal(t, nil, err, "Error from net.Dial()")
+	defer outbound.Close()
+	m := <-listen.Notify()
+	conn := m.(NewConnectionMessage).Conn
+
+	status := controlTestStatus(t, listen, StopAcceptMessage{})
+	assert.True(t, status.Closed, "Closed")
+
+	_, err = net.Dial("tcp", addr)
+	assert.NotEqual(t, nil, err, "Listening socket closed")
+
+	outbound.Write([]byte("Hello"))
+	m = <-conn.FromConn()
+	assert.Equal(t, "Hello", m.(DataMessage).String(), "Existing connection still up")
+	close(conn.ToConn())
+
+	select {
+	case listen.Control() <- StatusRequestMessage{}:
+	case <-time.After(time.Second):
+		t.Error("Control message blocked after stop")
+	}
+}
+
+func TestListenControlOtherListeners(t *testing.T) {
+	t.Parallel()
+
+	sshListen, err := NewSshListen("0", "127.0.0.1:0", SshListenOptions{NoClientAuth: true})
+	assert.Equal(t, nil, err, "SSH listener does not return error")
+	wsListen, err := NewWebsocketListen("0", "127.0.0.1:0")
+	assert.Equal(t, nil, err, "Websocket listener does not return error")
+	sniffListen, err := NewSniffListen("0", "127.0.0.1:0", SniffListenOptions{Timeout: time.Minute})
+	assert.Equal(t, nil, err, "Sniffing listener does not return error")
+
+	listeners := map[string]Connector{
+		sshListen.Addr.String():   sshListen,
+		wsListen.Addr.String():    wsListen,
+		sniffListen.Addr.String(): sniffListen,
+	}
+	for addr, listen := range listeners {
+		status := controlTestStatus(t, listen, StatusRequestMessage{})
+		expected := ListenerStatusMessage{Id: listen.Id(), Accepting: true}
+		assert.Equal(t, expected, status, "Initial status of "+listen.Id())
+
+		status = controlTestStatus(t, listen, PauseAcceptMessage{})
+		assert.False(t, status.Accepting, "Paused "+listen.Id())
+
+		// Connections are counted even before we know what they are
+		controlTestStatus(t, listen, ResumeAcceptMessage{})
+		outbound, err := net.Dial("tcp", addr)
+		assert.Equal(t, nil, err, "Error from net.Dial()")
+		for i := 0; i < 100; i++ {
+			status = controlTestStatus(t, listen, StatusRequestMessage{})
+			if status.Connections == 1 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.Equal(t, 1, status.Connections, "Connection counted by "+listen.Id())
+
+		status = controlTestStatus(t, listen, CloseListenerMessage{})
+		assert.True(t, status.Closed, "Closed "+listen.Id())
+
+		b := make([]byte, 1)
+		outbound.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, err = io.ReadFull(outbound, b)
+		for err == nil {
+			_, err = io.ReadFull(outbound, b)
+		}
+		assert.NotErrorIs(t, err, os.ErrDeadlineExceeded, "Connection dropped by "+listen.Id())
+		outbound.Close()
+
+		_, err = net.Dial("tcp", addr)
+		assert.NotEqual(t, nil, err, "Listening socket closed by "+listen.Id())
+	}
+}
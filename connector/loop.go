@@ -39,6 +39,9 @@ func (loop loopApp) repeat() {
 			// We just disconnect
 			log.Print("Disconnect received in loop connector")
 			return
+		case InputEndedMessage:
+			// Everything has been echoed, so we're done too
+			return
 		default:
 			log.Print("Unknown message type: " + m.TypeString())
 		}
@@ -9,14 +9,118 @@ type NewConnectionMessage struct {
 	Conn Connection
 }
 
-type DisconnectMessage struct{}
+type DisconnectMessage struct {
+	Exited     bool // Set by process connections, whose program has exited
+	ExitStatus int  // Only set if Exited, -1 if the program was killed by a signal
+	Reason     DisconnectReason
+}
 
 type DataMessage struct {
 	Data []byte
 }
 
 type ErrorMessage struct {
-	Err error
+	Err    error
+	Reason DisconnectReason // Set if the error ended the connection
+}
+
+// Why a connection went away, when it was something we noticed
+// rather than the far end hanging up.
+type DisconnectReason int
+
+const (
+	DisconnectReasonNone         DisconnectReason = iota
+	DisconnectReasonReadIdle                      // Nothing heard for too long
+	DisconnectReasonWriteTimeout                  // The far end stopped taking data
+	DisconnectReasonKeepAlive                     // The far end stopped answering keepalives
+)
+
+func (reason DisconnectReason) String() string {
+	switch reason {
+	case DisconnectReasonReadIdle:
+		return "read idle timeout"
+	case DisconnectReasonWriteTimeout:
+		return "write timeout"
+	case DisconnectReasonKeepAlive:
+		return "keepalive timeout"
+	}
+	return "none"
+}
+
+// The far end won't send anything more, although it may still be
+// listening.  Sent to a Connection, it tells the far end the same.
+type InputEndedMessage struct{}
+
+type WindowSizeMessage struct {
+	Width  int
+	Height int
+}
+
+type UrgentDataMessage struct {
+	Data []byte // Sent as TCP out-of-band data where supported
+}
+
+type TerminalTypeMessage struct {
+	Types []string // In the client's order of preference
+	Mtts  int      // MTTS capability bits, or 0 if the client didn't send them
+}
+
+// Variables from a telnet client's NEW-ENVIRON IS or INFO.  Variables
+// the client says are undefined are left out.
+type EnvironmentMessage struct {
+	Vars     map[string]string
+	UserVars map[string]string
+	Info     bool // Sent unasked, because something changed
+}
+
+// Sent to a telnet filter to turn an option on or off, either at our
+// end or (if Remote) the other end.  Once the other end has answered,
+// the filter sends back a TelnetOptionMessage.
+type TelnetOptionRequestMessage struct {
+	Option byte // Such as 1 for ECHO
+	Remote bool
+	Enable bool
+}
+
+type TelnetOptionMessage struct {
+	Option  byte
+	Remote  bool
+	Enabled bool
+}
+
+// Sent to a telnet filter to switch the client between editing lines
+// itself and sending each character as it is typed.  The filter sends
+// one back with the mode the client agreed to.
+type LineModeMessage struct {
+	Edit    bool // The client edits and echoes lines, sending them when done
+	TrapSig bool // The client sends interrupt and the like as telnet commands
+}
+
+type RloginHandshakeMessage struct {
+	LocalUser  string
+	RemoteUser string
+	Term       string
+	Speed      int
+}
+
+// Control messages understood by listeners.  Each is answered with a
+// ListenerStatusMessage on the listener's Notify() channel.
+type PauseAcceptMessage struct{}
+type ResumeAcceptMessage struct{}
+type StopAcceptMessage struct{}    // Stop listening, leave connections up
+type CloseListenerMessage struct{} // Stop listening and drop connections
+type StatusRequestMessage struct{}
+
+type SetMaxConnectionsMessage struct {
+	Max int // 0 is unlimited
+}
+
+type ListenerStatusMessage struct {
+	Id             string
+	Accepting      bool // False while paused or once closed
+	Closed         bool // No further messages will follow
+	Connections    int
+	MaxConnections int
 }
 
 type MessageType int64
@@ -26,17 +130,65 @@ const (
 	MTNewConnectionMessage
 	MTDataMessage
 	MTErrorMessage
+	MTWindowSizeMessage
+	MTUrgentDataMessage
+	MTRloginHandshakeMessage
+	MTPauseAcceptMessage
+	MTResumeAcceptMessage
+	MTStopAcceptMessage
+	MTCloseListenerMessage
+	MTStatusRequestMessage
+	MTSetMaxConnectionsMessage
+	MTListenerStatusMessage
+	MTInputEndedMessage
+	MTTerminalTypeMessage
+	MTEnvironmentMessage
+	MTTelnetOptionRequestMessage
+	MTTelnetOptionMessage
+	MTLineModeMessage
 )
 
-func (msg DisconnectMessage) Type() MessageType    { return MTDisconnectMessage }
-func (msg NewConnectionMessage) Type() MessageType { return MTNewConnectionMessage }
-func (msg DataMessage) Type() MessageType          { return MTDataMessage }
-func (msg ErrorMessage) Type() MessageType         { return MTErrorMessage }
+func (msg DisconnectMessage) Type() MessageType          { return MTDisconnectMessage }
+func (msg NewConnectionMessage) Type() MessageType       { return MTNewConnectionMessage }
+func (msg DataMessage) Type() MessageType                { return MTDataMessage }
+func (msg ErrorMessage) Type() MessageType               { return MTErrorMessage }
+func (msg WindowSizeMessage) Type() MessageType          { return MTWindowSizeMessage }
+func (msg UrgentDataMessage) Type() MessageType          { return MTUrgentDataMessage }
+func (msg RloginHandshakeMessage) Type() MessageType     { return MTRloginHandshakeMessage }
+func (msg PauseAcceptMessage) Type() MessageType         { return MTPauseAcceptMessage }
+func (msg ResumeAcceptMessage) Type() MessageType        { return MTResumeAcceptMessage }
+func (msg StopAcceptMessage) Type() MessageType          { return MTStopAcceptMessage }
+func (msg CloseListenerMessage) Type() MessageType       { return MTCloseListenerMessage }
+func (msg StatusRequestMessage) Type() MessageType       { return MTStatusRequestMessage }
+func (msg SetMaxConnectionsMessage) Type() MessageType   { return MTSetMaxConnectionsMessage }
+func (msg ListenerStatusMessage) Type() MessageType      { return MTListenerStatusMessage }
+func (msg InputEndedMessage) Type() MessageType          { return MTInputEndedMessage }
+func (msg TerminalTypeMessage) Type() MessageType        { return MTTerminalTypeMessage }
+func (msg EnvironmentMessage) Type() MessageType         { return MTEnvironmentMessage }
+func (msg TelnetOptionRequestMessage) Type() MessageType { return MTTelnetOptionRequestMessage }
+func (msg TelnetOptionMessage) Type() MessageType        { return MTTelnetOptionMessage }
+func (msg LineModeMessage) Type() MessageType            { return MTLineModeMessage }
 
-func (msg DisconnectMessage) TypeString() string    { return "DisconnectMessage" }
-func (msg NewConnectionMessage) TypeString() string { return "NewConnectionMessage" }
-func (msg DataMessage) TypeString() string          { return "DataMessage" }
-func (msg ErrorMessage) TypeString() string         { return "ErrorMessage" }
+func (msg DisconnectMessage) TypeString() string          { return "DisconnectMessage" }
+func (msg NewConnectionMessage) TypeString() string       { return "NewConnectionMessage" }
+func (msg DataMessage) TypeString() string                { return "DataMessage" }
+func (msg ErrorMessage) TypeString() string               { return "ErrorMessage" }
+func (msg WindowSizeMessage) TypeString() string          { return "WindowSizeMessage" }
+func (msg UrgentDataMessage) TypeString() string          { return "UrgentDataMessage" }
+func (msg RloginHandshakeMessage) TypeString() string     { return "RloginHandshakeMessage" }
+func (msg PauseAcceptMessage) TypeString() string         { return "PauseAcceptMessage" }
+func (msg ResumeAcceptMessage) TypeString() string        { return "ResumeAcceptMessage" }
+func (msg StopAcceptMessage) TypeString() string          { return "StopAcceptMessage" }
+func (msg CloseListenerMessage) TypeString() string       { return "CloseListenerMessage" }
+func (msg StatusRequestMessage) TypeString() string       { return "StatusRequestMessage" }
+func (msg SetMaxConnectionsMessage) TypeString() string   { return "SetMaxConnectionsMessage" }
+func (msg ListenerStatusMessage) TypeString() string      { return "ListenerStatusMessage" }
+func (msg InputEndedMessage) TypeString() string          { return "InputEndedMessage" }
+func (msg TerminalTypeMessage) TypeString() string        { return "TerminalTypeMessage" }
+func (msg EnvironmentMessage) TypeString() string         { return "EnvironmentMessage" }
+func (msg TelnetOptionRequestMessage) TypeString() string { return "TelnetOptionRequestMessage" }
+func (msg TelnetOptionMessage) TypeString() string        { return "TelnetOptionMessage" }
+func (msg LineModeMessage) TypeString() string            { return "LineModeMessage" }
 
 func NewDataMessage(b []byte) DataMessage {
 	return DataMessage{Data: b}
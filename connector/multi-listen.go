@@ -0,0 +1,190 @@
+package connector
+
+import (
+	"errors"
+	"net"
+	"strings"
+)
+
+type multiListen struct {
+	id        string
+	listeners []tcpListen
+	Addrs     []net.Addr       // Addresses we managed to listen on
+	Failed    map[string]error // Addresses we couldn't listen on
+	control   chan message
+	notify    chan message
+	statuses  chan multiListenStatus // From the listeners, for doControl
+}
+
+type multiListenStatus struct {
+	listener int
+	status   ListenerStatusMessage
+}
+
+func (listen multiListen) Id() string            { return listen.id }
+func (listen multiListen) Control() chan message { return listen.control }
+func (listen multiListen) Notify() chan message  { return listen.notify }
+
+func NewMultiListen(id string, addrs []string, opts TcpListenOptions) (multiListen, error) {
+	// One TCP listener per address, all reporting through our
+	// Notify().  New connections carry the ID of the listener that
+	// accepted them.  Control messages go to every listener, and we
+	// answer with one status for them all, which is Closed only
+	// once every listener has stopped.
+	//
+	// We carry on so long as at least one address works.  The ones
+	// that didn't are in Failed.
+	listen := multiListen{}
+	listen.id = id + "-TCPMulti-" + strings.Join(addrs, ",")
+	listen.Failed = make(map[string]error)
+	listen.control = make(chan message)
+	listen.notify = make(chan message)
+	listen.statuses = make(chan multiListenStatus)
+
+	for _, addr := range addrs {
+		tcp, err := newTcpListen(id, listenNetwork(addr), addr, opts)
+		if err != nil {
+			listen.Failed[addr] = err
+			continue
+		}
+		listen.listeners = append(listen.listeners, tcp)
+		listen.Addrs = append(listen.Addrs, tcp.Addr)
+	}
+
+	if len(listen.listeners) == 0 {
+		errs := make([]error, 0)
+		for _, addr := range addrs {
+			if listen.Failed[addr] != nil {
+				errs = append(errs, errors.New(addr+": "+listen.Failed[addr].Error()))
+			}
+		}
+		if len(errs) == 0 {
+			errs = append(errs, errors.New("no addresses to listen on"))
+		}
+		return listen, errors.Join(errs...)
+	}
+
+	for i, tcp := range listen.listeners {
+		go listen.forwardNotify(i, tcp)
+	}
+	go listen.doControl()
+
+	return listen, nil
+}
+
+func listenNetwork(addr string) string {
+	// An IPv6 wildcard normally also takes the IPv4 wildcard on the
+	// same port, which would stop us listening on both.  Asking for
+	// tcp6 gets us an IPv6-only socket.
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "tcp"
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return "tcp"
+	}
+	if ip.To4() != nil {
+		return "tcp4"
+	}
+	return "tcp6"
+}
+
+func (listen *multiListen) forwardNotify(i int, tcp tcpListen) {
+	// Statuses go to doControl to be combined, everything else
+	// straight to the app
+	for m := range tcp.Notify() {
+		status, ok := m.(ListenerStatusMessage)
+		if !ok {
+			listen.notify <- m
+			continue
+		}
+
+		listen.statuses <- multiListenStatus{listener: i, status: status}
+		if status.Closed {
+			return
+		}
+	}
+}
+
+func (listen *multiListen) doControl() {
+	// We keep reading until Control() is closed, even once every
+	// listener has stopped, so senders never get stuck.
+	statuses := make([]ListenerStatusMessage, len(listen.listeners))
+	for i := range statuses {
+		// Until we hear otherwise
+		statuses[i].Accepting = true
+	}
+	running := len(listen.listeners)
+
+	record := func(s multiListenStatus) {
+		statuses[s.listener] = s.status
+		if s.status.Closed {
+			running--
+		}
+	}
+
+	for running > 0 {
+		select {
+		case s := <-listen.statuses:
+			// A listener stopped by itself
+			record(s)
+			listen.notify <- listen.status(statuses, running)
+		case m, ok := <-listen.control:
+			if !ok {
+				return
+			}
+			if !multiListenControl(m) {
+				listen.notify <- ErrorMessage{Err: errors.New("unknown control message type: " + m.TypeString())}
+				continue
+			}
+
+			// Each running listener answers in turn.  One that stops
+			// while we ask answers with its Closed status instead.
+			for i, tcp := range listen.listeners {
+				if statuses[i].Closed {
+					continue
+				}
+				select {
+				case tcp.Control() <- m:
+				case <-tcp.done:
+				}
+				for !statuses[i].Closed {
+					s := <-listen.statuses
+					record(s)
+					if s.listener == i {
+						break
+					}
+				}
+			}
+			listen.notify <- listen.status(statuses, running)
+		}
+	}
+
+	drainMessages(listen.control)
+}
+
+func multiListenControl(m message) bool {
+	switch m.(type) {
+	case PauseAcceptMessage, ResumeAcceptMessage, SetMaxConnectionsMessage, StatusRequestMessage,
+		StopAcceptMessage, CloseListenerMessage:
+		return true
+	}
+	return false
+}
+
+func (listen *multiListen) status(statuses []ListenerStatusMessage, running int) ListenerStatusMessage {
+	status := ListenerStatusMessage{}
+	status.Id = listen.id
+	status.Closed = running == 0
+	for _, s := range statuses {
+		status.Accepting = status.Accepting || s.Accepting
+		status.Connections += s.Connections
+		if s.MaxConnections > status.MaxConnections {
+			// Every listener is given the same limit
+			status.MaxConnections = s.MaxConnections
+		}
+	}
+	return status
+}
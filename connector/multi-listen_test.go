@@ -0,0 +1,130 @@
+package connector
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func multiListenTestIpv6(t *testing.T) {
+	l, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 loopback not available: " + err.Error())
+	}
+	l.Close()
+}
+
+func TestMultiListen(t *testing.T) {
+	t.Parallel()
+	multiListenTestIpv6(t)
+
+	addrs := []string{"127.0.0.1:0", "[::1]:0", "127.0.0.1:99999"}
+	listen, err := NewMultiListen("0", addrs, TcpListenOptions{})
+	assert.Equal(t, nil, err, "Listener does not return error with one bad address")
+	assert.Equal(t, "0-TCPMulti-"+strings.Join(addrs, ","), listen.Id(), "Listener ID correct")
+	assert.Equal(t, 2, len(listen.Addrs), "Two addresses listening")
+	assert.Equal(t, 1, len(listen.Failed), "One address failed")
+	assert.NotEqual(t, nil, listen.Failed["127.0.0.1:99999"], "Unavailable address reported")
+
+	for _, addr := range listen.Addrs {
+		outbound, err := net.Dial("tcp", addr.String())
+		assert.Equal(t, nil, err, "Error from net.Dial()")
+		defer outbound.Close()
+
+		m := <-listen.Notify()
+		conn := m.(NewConnectionMessage).Conn
+		assert.Equal(t, "0-TCP-"+addr.String()+"-"+outbound.LocalAddr().String(), conn.Id(), "Connection ID names the accepting address")
+
+		outbound.Write([]byte("Hello"))
+		m = <-conn.FromConn()
+		assert.Equal(t, "Hello", m.(DataMessage).String(), "Data received")
+		close(conn.ToConn())
+	}
+
+	// One answer for them all
+	listen.Control() <- SetMaxConnectionsMessage{Max: 5}
+	// The connections above may not have gone yet, so we don't
+	// check how many there are
+	m := <-listen.Notify()
+	status := m.(ListenerStatusMessage)
+	assert.Equal(t, listen.Id(), status.Id, "Status has our ID")
+	assert.True(t, status.Accepting, "Accepting")
+	assert.Equal(t, 5, status.MaxConnections, "Limit set on every listener")
+
+	listen.Control() <- CloseListenerMessage{}
+	m = <-listen.Notify()
+	status = m.(ListenerStatusMessage)
+	assert.Equal(t, listen.Id(), status.Id, "Closed status has our ID")
+	assert.True(t, status.Closed, "Closed once")
+	select {
+	case m = <-listen.Notify():
+		t.Error("Message after Closed: " + m.TypeString())
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	select {
+	case listen.Control() <- StatusRequestMessage{}:
+	case <-time.After(time.Second):
+		t.Error("Control message blocked after close")
+	}
+}
+
+func TestMultiListenOneStopped(t *testing.T) {
+	t.Parallel()
+
+	listen, err := NewMultiListen("0", []string{"127.0.0.1:0", "127.0.0.1:0"}, TcpListenOptions{})
+	assert.Equal(t, nil, err, "Listener does not return error")
+
+	// One listener stops behind our back, which doesn't close us
+	listen.listeners[0].Control() <- StopAcceptMessage{}
+	m := <-listen.Notify()
+	assert.Equal(t, ListenerStatusMessage{Id: listen.Id(), Accepting: true}, m, "Still listening")
+
+	done := make(chan struct{})
+	go func() {
+		listen.Control() <- StatusRequestMessage{}
+		close(done)
+	}()
+	m = <-listen.Notify()
+	assert.Equal(t, listen.Id(), m.(ListenerStatusMessage).Id, "Running listener answers")
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Control message blocked by stopped listener")
+	}
+
+	listen.Control() <- StopAcceptMessage{}
+	m = <-listen.Notify()
+	assert.True(t, m.(ListenerStatusMessage).Closed, "Closed when the last listener stops")
+}
+
+func TestMultiListenDualStack(t *testing.T) {
+	t.Parallel()
+	multiListenTestIpv6(t)
+
+	listen, err := NewMultiListen("0", []string{"[::]:0"}, TcpListenOptions{})
+	assert.Equal(t, nil, err, "Listener does not return error")
+	_, port, _ := net.SplitHostPort(listen.Addrs[0].String())
+
+	// The IPv6 wildcard leaves the IPv4 one free
+	l, err := net.Listen("tcp4", "0.0.0.0:"+port)
+	assert.Equal(t, nil, err, "IPv4 wildcard still available")
+	l.Close()
+
+	listen.Control() <- CloseListenerMessage{}
+	<-listen.Notify()
+}
+
+func TestMultiListenFailure(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewMultiListen("0", []string{"127.0.0.1:99999", "[::1]:99999"}, TcpListenOptions{})
+	assert.NotEqual(t, nil, err, "All addresses failing returns error")
+	assert.Contains(t, err.Error(), "[::1]:99999", "Every failure reported")
+
+	_, err = NewMultiListen("0", []string{}, TcpListenOptions{})
+	assert.NotEqual(t, nil, err, "No addresses returns error")
+}
@@ -12,6 +12,11 @@ func (filter newlineOutFilter) Id() string             { return filter.id }
 func (filter newlineOutFilter) FromConn() chan message { return filter.fromClient }
 func (filter newlineOutFilter) ToConn() chan message   { return filter.toClient }
 
+func (filter newlineOutFilter) Attributes() *ConnAttributes {
+	attributes, _ := ConnectionAttributes(filter.inboundConnection)
+	return attributes
+}
+
 func NewNewlineOutFilter(conn Connection) (newlineOutFilter, error) {
 	filter := newlineOutFilter{}
 
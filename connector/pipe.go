@@ -0,0 +1,75 @@
+package connector
+
+type pipeConn struct {
+	id       string
+	fromConn chan message
+	toConn   chan message
+	ended    chan struct{} // Closed once our user is done with us
+}
+
+func (conn pipeConn) Id() string             { return conn.id }
+func (conn pipeConn) FromConn() chan message { return conn.fromConn }
+func (conn pipeConn) ToConn() chan message   { return conn.toConn }
+
+func NewPipePair(id string) (pipeConn, pipeConn, error) {
+	// Two connections joined back to back.  Whatever is sent to one's
+	// ToConn() comes out of the other's FromConn(), much like the two
+	// ends of a TCP connection, but without a socket.
+	a := newPipeConn(id + "-Pipe-A")
+	b := newPipeConn(id + "-Pipe-B")
+
+	go a.forward(b)
+	go b.forward(a)
+
+	return a, b, nil
+}
+
+func newPipeConn(id string) pipeConn {
+	conn := pipeConn{}
+	conn.id = id
+	conn.fromConn = make(chan message)
+	conn.toConn = make(chan message)
+	conn.ended = make(chan struct{})
+	return conn
+}
+
+func (conn pipeConn) forward(peer pipeConn) {
+	// Passes messages from our user to the peer's user.  When our user
+	// closes ToConn() or sends a DisconnectMessage, the peer sees a
+	// DisconnectMessage and both FromConn() channels are closed.
+	for {
+		select {
+		case m, ok := <-conn.toConn:
+			if !ok || m.Type() == MTDisconnectMessage {
+				close(conn.ended)
+				conn.deliver(peer, DisconnectMessage{})
+				close(peer.fromConn)
+				return
+			}
+			conn.deliver(peer, m)
+		case <-peer.ended:
+			close(peer.fromConn)
+			conn.discard()
+			return
+		}
+	}
+}
+
+func (conn pipeConn) deliver(peer pipeConn, m message) {
+	select {
+	case peer.fromConn <- m:
+	case <-peer.ended:
+	}
+}
+
+func (conn pipeConn) discard() {
+	// The other end is gone, so throw away anything our user still
+	// sends until they notice.
+	for {
+		m, ok := <-conn.toConn
+		if !ok || m.Type() == MTDisconnectMessage {
+			close(conn.ended)
+			return
+		}
+	}
+}
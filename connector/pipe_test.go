@@ -0,0 +1,65 @@
+package connector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipePair(t *testing.T) {
+	t.Parallel()
+
+	a, b, err := NewPipePair("0")
+	assert.Equal(t, nil, err, "No pipe error")
+	assert.Equal(t, "0-Pipe-A", a.Id(), "Pipe A ID is proper")
+	assert.Equal(t, "0-Pipe-B", b.Id(), "Pipe B ID is proper")
+
+	a.ToConn() <- NewDataMessageFromString("Hello")
+	m := <-b.FromConn()
+	assert.Equal(t, "Hello", m.(DataMessage).String(), "Data from A to B")
+
+	b.ToConn() <- NewDataMessageFromString("World")
+	m = <-a.FromConn()
+	assert.Equal(t, "World", m.(DataMessage).String(), "Data from B to A")
+
+	// Not just data
+	a.ToConn() <- WindowSizeMessage{Width: 80, Height: 24}
+	m = <-b.FromConn()
+	assert.Equal(t, WindowSizeMessage{Width: 80, Height: 24}, m, "Window size from A to B")
+
+	close(a.ToConn())
+	m, ok := <-b.FromConn()
+	assert.True(t, ok, "B channel open")
+	assert.IsType(t, DisconnectMessage{}, m, "B told of disconnect")
+	_, ok = <-b.FromConn()
+	assert.False(t, ok, "B channel closed")
+	_, ok = <-a.FromConn()
+	assert.False(t, ok, "A channel closed")
+
+	// Nobody is listening, but B's user isn't stuck
+	b.ToConn() <- NewDataMessageFromString("Anyone?")
+	close(b.ToConn())
+}
+
+func TestPipePairDisconnect(t *testing.T) {
+	t.Parallel()
+
+	a, b, err := NewPipePair("0")
+	assert.Equal(t, nil, err, "No pipe error")
+
+	filter, err := NewNewlineOutFilter(b)
+	assert.Equal(t, nil, err, "No filter error")
+	assert.Equal(t, "0-Pipe-B-(newline)", filter.Id(), "Filter wraps the pipe")
+
+	a.ToConn() <- NewDataMessageFromString("Hello\n")
+	m := <-filter.FromConn()
+	assert.Equal(t, "Hello\n\r", m.(DataMessage).String(), "Data through pipe and filter")
+
+	filter.ToConn() <- DisconnectMessage{}
+	m, ok := <-a.FromConn()
+	assert.True(t, ok, "A channel open")
+	assert.IsType(t, DisconnectMessage{}, m, "A told of disconnect")
+	_, ok = <-a.FromConn()
+	assert.False(t, ok, "A channel closed")
+	close(a.ToConn())
+}
@@ -0,0 +1,107 @@
+package connector
+
+import (
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"github.com/creack/pty"
+)
+
+type processConn struct {
+	id       string
+	cmd      *exec.Cmd
+	pty      *os.File
+	fromConn chan message
+	toConn   chan message
+}
+
+func (proc processConn) Id() string             { return proc.id }
+func (proc processConn) FromConn() chan message { return proc.fromConn }
+func (proc processConn) ToConn() chan message   { return proc.toConn }
+func (proc processConn) Pid() int               { return proc.cmd.Process.Pid }
+
+func NewProcessConnection(cmd string, args []string, env []string) (processConn, error) {
+	// Runs cmd under a new pseudo-terminal.  A nil env gives the
+	// program our own environment.
+	proc := processConn{}
+
+	proc.cmd = exec.Command(cmd, args...)
+	proc.cmd.Env = env
+
+	ptmx, err := pty.Start(proc.cmd)
+	if err != nil {
+		return proc, err
+	}
+	proc.pty = ptmx
+	proc.id = "Process-" + cmd + "-" + strconv.Itoa(proc.cmd.Process.Pid)
+	proc.fromConn = make(chan message)
+	proc.toConn = make(chan message)
+
+	go proc.connectionInputHandler()
+	go proc.connectionOutputHandler()
+
+	return proc, nil
+}
+
+func (proc *processConn) connectionOutputHandler() {
+	defer close(proc.fromConn)
+
+	b := make([]byte, 65535)
+	n, err := io.ReadAtLeast(proc.pty, b, 1)
+	for err == nil && n > 0 {
+		newSlice := make([]byte, n)
+		copy(newSlice, b[:n])
+		proc.fromConn <- DataMessage{Data: newSlice}
+		n, err = io.ReadAtLeast(proc.pty, b, 1)
+	}
+
+	// Linux returns EIO rather than EOF once the child has exited
+	// and closed its side of the pty, so any error here means the
+	// program is gone (or we killed it).
+	proc.cmd.Wait()
+	proc.fromConn <- DisconnectMessage{Exited: true, ExitStatus: proc.cmd.ProcessState.ExitCode()}
+}
+
+func (proc *processConn) connectionInputHandler() {
+	// If writing fails our user finds out from the output handler,
+	// and we don't want them stuck sending to us until then.
+	failed := false
+	defer func() {
+		if failed {
+			drainMessages(proc.toConn)
+		}
+	}()
+	defer proc.pty.Close()
+	defer proc.cmd.Process.Kill()
+	for {
+		m, ok := <-proc.toConn
+		if !ok {
+			return
+		}
+
+		switch m.(type) {
+		case DataMessage:
+			dataMsg := m.(DataMessage)
+			b := dataMsg.Data
+			n, err := proc.pty.Write(b)
+			if err != nil || n != len(b) {
+				log.Print("Could not write full message to process")
+				failed = true
+				return
+			}
+		case WindowSizeMessage:
+			size := m.(WindowSizeMessage)
+			err := pty.Setsize(proc.pty, &pty.Winsize{Cols: uint16(size.Width), Rows: uint16(size.Height)})
+			if err != nil {
+				log.Print("Could not set process window size: " + err.Error())
+			}
+		case DisconnectMessage:
+			return
+		default:
+			log.Print("Unknown message type: " + m.TypeString())
+		}
+	}
+}
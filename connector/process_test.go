@@ -0,0 +1,88 @@
+package connector
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessConnection(t *testing.T) {
+	t.Parallel()
+
+	env := []string{"PATH=" + os.Getenv("PATH"), "GREETING=hi"}
+	script := "read x; stty size; echo $GREETING $x; exit 3"
+	proc, err := NewProcessConnection("/bin/sh", []string{"-c", script}, env)
+	assert.Equal(t, nil, err, "Process started")
+	assert.Regexp(t, "^Process-/bin/sh-[0-9]+$", proc.Id(), "Process ID correct")
+
+	proc.ToConn() <- WindowSizeMessage{Width: 132, Height: 50}
+	proc.ToConn() <- NewDataMessageFromString("there\n")
+
+	output := ""
+	for {
+		m, ok := <-proc.FromConn()
+		assert.True(t, ok, "Channel open")
+		if m.Type() == MTDisconnectMessage {
+			assert.Equal(t, DisconnectMessage{Exited: true, ExitStatus: 3}, m, "Exit status received")
+			break
+		}
+		output += m.(DataMessage).String()
+	}
+	assert.True(t, strings.Contains(output, "50 132"), "Window size set: "+output)
+	assert.True(t, strings.Contains(output, "hi there"), "Data passed: "+output)
+
+	_, ok := <-proc.FromConn()
+	assert.False(t, ok, "Channel closed")
+	close(proc.ToConn())
+}
+
+func TestProcessConnectionKill(t *testing.T) {
+	t.Parallel()
+
+	proc, err := NewProcessConnection("/bin/sh", []string{"-c", "sleep 60"}, nil)
+	assert.Equal(t, nil, err, "Process started")
+
+	start := time.Now()
+	close(proc.ToConn())
+	exited := false
+	for m := range proc.FromConn() {
+		if m.Type() == MTDisconnectMessage {
+			assert.Equal(t, DisconnectMessage{Exited: true, ExitStatus: -1}, m, "Killed by signal")
+			exited = true
+		}
+	}
+	assert.True(t, exited, "Exit status received")
+	assert.Less(t, time.Since(start), 10*time.Second, "Process killed")
+}
+
+func TestProcessConnectionWriteFailure(t *testing.T) {
+	t.Parallel()
+
+	proc, err := NewProcessConnection("/bin/sh", []string{"-c", "sleep 60"}, nil)
+	assert.Equal(t, nil, err, "Process started")
+
+	// Writes to a pty whose program has gone still succeed, so we
+	// break it ourselves
+	proc.pty.Close()
+	for i := 0; i < 2; i++ {
+		select {
+		case proc.ToConn() <- NewDataMessageFromString("Hello"):
+		case <-time.After(time.Second):
+			t.Fatal("Send blocked after write failure")
+		}
+	}
+
+	close(proc.ToConn())
+	for range proc.FromConn() {
+	}
+}
+
+func TestProcessConnectionFailure(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewProcessConnection("/nonexistent/program", nil, nil)
+	assert.NotEqual(t, nil, err, "Missing program returns error")
+}
@@ -0,0 +1,260 @@
+package connector
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Load balancers get this long to send the PROXY header before we
+// drop the connection.
+const proxyHeaderTimeout = 10 * time.Second
+
+// Connection attribute set from each PROXY v2 TLV, followed by its
+// type in decimal.  The value is in hex, comma separated if the type
+// appears more than once.
+const AttrProxyTlv = "proxy-tlv:"
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// Type-length-value extension from a PROXY v2 header
+type ProxyTLV struct {
+	Type  byte
+	Value []byte
+}
+
+type proxyHeader struct {
+	remote net.Addr // Nil if the header didn't carry addresses
+	local  net.Addr
+	tlvs   []ProxyTLV
+}
+
+// A connection that came through a load balancer.  Reads go through
+// the buffered reader since it may hold data that followed the header.
+type proxyConn struct {
+	net.Conn
+	reader *bufio.Reader
+	remote net.Addr
+	local  net.Addr
+	tlvs   []ProxyTLV
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) { return c.reader.Read(b) }
+func (c *proxyConn) RemoteAddr() net.Addr       { return c.remote }
+func (c *proxyConn) LocalAddr() net.Addr        { return c.local }
+
+func (tcp tcpConn) ProxyTLVs() []ProxyTLV {
+	pc, ok := tcp.conn.(*proxyConn)
+	if !ok {
+		return nil
+	}
+	return pc.tlvs
+}
+
+func (listen *tcpListen) trustedProxy(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+
+	for _, n := range listen.opts.ProxyTrusted {
+		if n.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func (listen *tcpListen) acceptProxy(conn net.Conn) {
+	if !listen.trustedProxy(conn.RemoteAddr()) {
+		// Anyone else could claim to be anybody, so we don't
+		// even look for a header.
+		listen.connectionReady(conn)
+		return
+	}
+
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+	header, err := readProxyHeader(reader)
+	if err != nil {
+		log.Print("Invalid PROXY header from " + conn.RemoteAddr().String() + ": " + err.Error())
+		conn.Close()
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	pc := &proxyConn{}
+	pc.Conn = conn
+	pc.reader = reader
+	pc.remote = conn.RemoteAddr()
+	pc.local = conn.LocalAddr()
+	pc.tlvs = header.tlvs
+	if header.remote != nil {
+		pc.remote = header.remote
+		pc.local = header.local
+	}
+
+	listen.connectionReady(pc)
+}
+
+func readProxyHeader(r *bufio.Reader) (proxyHeader, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return proxyHeader{}, err
+	}
+
+	if b[0] == 'P' {
+		return readProxyHeaderV1(r)
+	} else if b[0] == '\r' {
+		return readProxyHeaderV2(r)
+	}
+	return proxyHeader{}, errors.New("no PROXY header")
+}
+
+func readProxyHeaderV1(r *bufio.Reader) (proxyHeader, error) {
+	// Human readable, such as:
+	//   PROXY TCP4 192.0.2.1 192.0.2.2 56324 23\r\n
+	// The spec limits this to 107 bytes including the CRLF.
+	header := proxyHeader{}
+
+	line := make([]byte, 0, 107)
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return header, err
+		}
+		line = append(line, c)
+		if c == '\n' {
+			break
+		}
+		if len(line) >= 107 {
+			return header, errors.New("v1 header too long")
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return header, errors.New("v1 header not terminated by CRLF")
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return header, errors.New("invalid v1 header")
+	}
+
+	switch fields[1] {
+	case "UNKNOWN":
+		// The balancer doesn't know the addresses, so we use
+		// our own.
+		return header, nil
+	case "TCP4", "TCP6":
+	default:
+		return header, errors.New("unknown v1 protocol " + fields[1])
+	}
+
+	if len(fields) != 6 {
+		return header, errors.New("invalid v1 header")
+	}
+	src := net.ParseIP(fields[2])
+	dst := net.ParseIP(fields[3])
+	srcPort, srcErr := strconv.ParseUint(fields[4], 10, 16)
+	dstPort, dstErr := strconv.ParseUint(fields[5], 10, 16)
+	if src == nil || dst == nil || srcErr != nil || dstErr != nil {
+		return header, errors.New("invalid v1 addresses")
+	}
+
+	header.remote = &net.TCPAddr{IP: src, Port: int(srcPort)}
+	header.local = &net.TCPAddr{IP: dst, Port: int(dstPort)}
+	return header, nil
+}
+
+func readProxyHeaderV2(r *bufio.Reader) (proxyHeader, error) {
+	// Binary: a 12 byte signature, version/command, family/protocol,
+	// then a 16 bit length of the addresses and TLVs that follow.
+	header := proxyHeader{}
+
+	fixed := make([]byte, 16)
+	_, err := io.ReadFull(r, fixed)
+	if err != nil {
+		return header, err
+	}
+	if !bytes.Equal(fixed[:12], proxyV2Signature) {
+		return header, errors.New("invalid v2 signature")
+	}
+	if fixed[12]>>4 != 2 {
+		return header, errors.New("unsupported PROXY version")
+	}
+	command := fixed[12] & 0x0f
+	family := fixed[13] >> 4
+	protocol := fixed[13] & 0x0f
+
+	body := make([]byte, binary.BigEndian.Uint16(fixed[14:16]))
+	_, err = io.ReadFull(r, body)
+	if err != nil {
+		return header, err
+	}
+
+	if command == 0 {
+		// LOCAL, such as a health check from the balancer
+		// itself.
+		return header, nil
+	} else if command != 1 {
+		return header, errors.New("unknown v2 command")
+	}
+
+	addrLen := 0
+	switch family {
+	case 0: // Unspecified
+	case 1: // IPv4
+		addrLen = 12
+	case 2: // IPv6
+		addrLen = 36
+	case 3: // Unix
+		addrLen = 216
+	default:
+		return header, errors.New("unknown v2 address family")
+	}
+	if len(body) < addrLen {
+		return header, errors.New("v2 header too short for addresses")
+	}
+
+	// We only care about the addresses of TCP streams
+	if protocol == 1 && (family == 1 || family == 2) {
+		ipLen := (addrLen - 4) / 2
+		src := make(net.IP, ipLen)
+		dst := make(net.IP, ipLen)
+		copy(src, body[:ipLen])
+		copy(dst, body[ipLen:2*ipLen])
+		srcPort := binary.BigEndian.Uint16(body[2*ipLen:])
+		dstPort := binary.BigEndian.Uint16(body[2*ipLen+2:])
+
+		header.remote = &net.TCPAddr{IP: src, Port: int(srcPort)}
+		header.local = &net.TCPAddr{IP: dst, Port: int(dstPort)}
+	}
+
+	header.tlvs, err = parseProxyTLVs(body[addrLen:])
+	return header, err
+}
+
+func parseProxyTLVs(b []byte) ([]ProxyTLV, error) {
+	tlvs := make([]ProxyTLV, 0)
+	for len(b) > 0 {
+		if len(b) < 3 {
+			return tlvs, errors.New("truncated v2 TLV")
+		}
+		l := int(binary.BigEndian.Uint16(b[1:3]))
+		if len(b) < 3+l {
+			return tlvs, errors.New("truncated v2 TLV")
+		}
+
+		tlvs = append(tlvs, ProxyTLV{Type: b[0], Value: b[3 : 3+l]})
+		b = b[3+l:]
+	}
+
+	return tlvs, nil
+}
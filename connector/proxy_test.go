@@ -0,0 +1,116 @@
+package connector
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func proxyTestListen(t *testing.T, trusted string) tcpListen {
+	_, n, err := net.ParseCIDR(trusted)
+	assert.Equal(t, nil, err, "CIDR parsed")
+
+	opts := TcpListenOptions{ProxyProtocol: true, ProxyTrusted: []*net.IPNet{n}}
+	listen, err := NewTcpListenWithOptions("0", "127.0.0.1:0", opts)
+	assert.Equal(t, nil, err, "Listener does not return error")
+
+	return listen
+}
+
+func proxyTestConnect(t *testing.T, listen tcpListen, header []byte) (net.Conn, tcpConn) {
+	outbound, err := net.Dial("tcp", listen.Addr.String())
+	assert.Equal(t, nil, err, "Error from net.Dial()")
+	outbound.Write(header)
+
+	m := <-listen.Notify()
+	assert.IsType(t, NewConnectionMessage{}, m, "New connection message")
+
+	return outbound, m.(NewConnectionMessage).Conn.(tcpConn)
+}
+
+func TestProxyProtocolV1(t *testing.T) {
+	t.Parallel()
+
+	listen := proxyTestListen(t, "127.0.0.0/8")
+
+	outbound, conn := proxyTestConnect(t, listen, []byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 23\r\nHello"))
+	assert.Equal(t, "192.0.2.1:56324", conn.RemoteAddr().String(), "Remote address from header")
+	assert.Equal(t, listen.Id()+"-192.0.2.1:56324", conn.Id(), "Connection ID uses real client")
+
+	m := <-conn.FromConn()
+	assert.Equal(t, "Hello", m.(DataMessage).String(), "Data after header passed through")
+
+	outbound.Close()
+	close(conn.ToConn())
+
+	outbound, conn = proxyTestConnect(t, listen, []byte("PROXY UNKNOWN\r\n"))
+	assert.Equal(t, outbound.LocalAddr().String(), conn.RemoteAddr().String(), "UNKNOWN keeps real address")
+	outbound.Close()
+	close(conn.ToConn())
+}
+
+func TestProxyProtocolV2(t *testing.T) {
+	t.Parallel()
+
+	listen := proxyTestListen(t, "127.0.0.0/8")
+
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x21, 0x21, 0, 36+7) // PROXY, TCP over IPv6
+	header = append(header, net.ParseIP("2001:db8::1")...)
+	header = append(header, net.ParseIP("2001:db8::2")...)
+	header = append(header, 0x1f, 0x90, 0x00, 0x17) // Ports 8080, 23
+	header = append(header, 0xe0, 0, 4, 't', 'e', 's', 't')
+	header = append(header, []byte("Hello")...)
+
+	outbound, conn := proxyTestConnect(t, listen, header)
+	assert.Equal(t, "[2001:db8::1]:8080", conn.RemoteAddr().String(), "Remote address from header")
+	assert.Equal(t, []ProxyTLV{{Type: 0xe0, Value: []byte("test")}}, conn.ProxyTLVs(), "TLVs parsed")
+	value, _ := conn.Attributes().Get(AttrProxyTlv + "224")
+	assert.Equal(t, "74657374", value, "TLV recorded")
+
+	m := <-conn.FromConn()
+	assert.Equal(t, "Hello", m.(DataMessage).String(), "Data after header passed through")
+	outbound.Close()
+	close(conn.ToConn())
+
+	// LOCAL command, used for health checks
+	header = append([]byte{}, proxyV2Signature...)
+	header = append(header, 0x20, 0x00, 0, 0)
+	outbound, conn = proxyTestConnect(t, listen, header)
+	assert.Equal(t, outbound.LocalAddr().String(), conn.RemoteAddr().String(), "LOCAL keeps real address")
+	outbound.Close()
+	close(conn.ToConn())
+}
+
+func TestProxyProtocolInvalid(t *testing.T) {
+	t.Parallel()
+
+	listen := proxyTestListen(t, "127.0.0.0/8")
+
+	outbound, err := net.Dial("tcp", listen.Addr.String())
+	assert.Equal(t, nil, err, "Error from net.Dial()")
+	outbound.Write([]byte("GET / HTTP/1.0\r\n\r\n"))
+
+	b := make([]byte, 1)
+	_, err = outbound.Read(b)
+	assert.NotEqual(t, nil, err, "Connection without header closed")
+	outbound.Close()
+}
+
+func TestProxyProtocolUntrusted(t *testing.T) {
+	t.Parallel()
+
+	listen := proxyTestListen(t, "10.0.0.0/8")
+
+	outbound, conn := proxyTestConnect(t, listen, []byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 23\r\n"))
+	assert.Equal(t, outbound.LocalAddr().String(), conn.RemoteAddr().String(), "Untrusted header ignored")
+
+	m := <-conn.FromConn()
+	assert.Equal(t, "PROXY TCP4 192.0.2.1 192.0.2.2 56324 23\r\n", m.(DataMessage).String(), "Header treated as data")
+	outbound.Close()
+	close(conn.ToConn())
+
+	_, err := NewTcpListenWithOptions("0", "127.0.0.1:0", TcpListenOptions{ProxyProtocol: true})
+	assert.NotEqual(t, nil, err, "Trusted sources required")
+}
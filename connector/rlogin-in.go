@@ -0,0 +1,273 @@
+package connector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	rloginUrgentWindow byte = 0x80 // Asks the client to report window sizes
+	rloginMaxHandshake      = 1024 // Longest handshake we'll wait for
+)
+
+// Window size reports start with this, followed by 16 bit rows,
+// columns, x pixels and y pixels.
+var rloginWindowCookie = []byte{0xff, 0xff, 's', 's'}
+
+const rloginWindowLength = 12
+
+type rloginListen struct {
+	id     string
+	tcp    tcpListen
+	Addr   net.Addr
+	notify chan message
+}
+
+func (listen rloginListen) Id() string            { return listen.id }
+func (listen rloginListen) Control() chan message { return listen.tcp.Control() }
+func (listen rloginListen) Notify() chan message  { return listen.notify }
+
+type rloginFilter struct {
+	id                string
+	inboundConnection Connection
+	fromClient        chan message
+	toClient          chan message
+	readBuffer        []byte // Partial handshake or window size report
+	writeBuffer       []byte // Output held until the handshake is done
+	handshakeDone     bool
+	hungUp            bool // We gave up on the client
+}
+
+func (rlogin rloginFilter) Id() string             { return rlogin.id }
+func (rlogin rloginFilter) FromConn() chan message { return rlogin.fromClient }
+func (rlogin rloginFilter) ToConn() chan message   { return rlogin.toClient }
+
+func (rlogin rloginFilter) Attributes() *ConnAttributes {
+	attributes, _ := ConnectionAttributes(rlogin.inboundConnection)
+	return attributes
+}
+
+func NewRloginListen(id string, addr string) (rloginListen, error) {
+	// A TCP listener that puts an rlogin filter on every new
+	// connection.
+	// Connection IDs start with our ID rather than a TCP one.
+	listen := rloginListen{}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return listen, err
+	}
+	tcp := tcpListen{}
+	tcp.listener = l
+	tcp.Addr = l.Addr()
+	tcp.id = id + "-RLOGIN-" + tcp.Addr.String()
+	tcp.fillDefaults()
+	go tcp.doListen()
+
+	listen.tcp = tcp
+	listen.Addr = tcp.Addr
+	listen.id = tcp.id
+	listen.notify = make(chan message)
+
+	go listen.doListen()
+
+	return listen, nil
+}
+
+func (listen *rloginListen) doListen() {
+	defer close(listen.notify)
+
+	for m := range listen.tcp.Notify() {
+		if m.Type() != MTNewConnectionMessage {
+			listen.notify <- m
+			continue
+		}
+
+		filter, err := NewRloginFilter(m.(NewConnectionMessage).Conn)
+		if err != nil {
+			log.Print(err)
+			continue
+		}
+
+		msg := NewConnectionMessage{}
+		msg.Conn = filter
+		listen.notify <- msg
+	}
+}
+
+func NewRloginFilter(conn Connection) (rloginFilter, error) {
+	rlogin := rloginFilter{}
+
+	rlogin.inboundConnection = conn
+	rlogin.id = conn.Id() + "-(rlogin)"
+	rlogin.fillDefaults()
+
+	go rlogin.doFilter()
+
+	return rlogin, nil
+}
+
+func (rlogin *rloginFilter) fillDefaults() {
+	rlogin.fromClient = make(chan message)
+	rlogin.toClient = make(chan message)
+	rlogin.readBuffer = make([]byte, 0)
+	rlogin.writeBuffer = make([]byte, 0)
+}
+
+func (rlogin *rloginFilter) doFilter() {
+	defer close(rlogin.inboundConnection.ToConn())
+	defer close(rlogin.fromClient)
+
+	for {
+		select {
+		case m, ok := <-rlogin.inboundConnection.FromConn():
+			if !ok {
+				return
+			}
+			rlogin.processFromInboundConnection(m)
+		case m, ok := <-rlogin.toClient:
+			if !ok {
+				return
+			}
+			rlogin.processToClient(m)
+		}
+	}
+}
+
+func (rlogin *rloginFilter) processFromInboundConnection(m message) {
+	if m.Type() != MTDataMessage {
+		rlogin.fromClient <- m
+		return
+	}
+	if rlogin.hungUp {
+		return
+	}
+
+	msg := m.(DataMessage)
+	b := append(rlogin.readBuffer, msg.Data...)
+	rlogin.readBuffer = make([]byte, 0)
+
+	if !rlogin.handshakeDone {
+		b = rlogin.processHandshake(b)
+		if !rlogin.handshakeDone {
+			return
+		}
+	}
+
+	rlogin.processInboundData(b)
+}
+
+func (rlogin *rloginFilter) processHandshake(b []byte) []byte {
+	// The client starts with four NUL terminated fields:
+	//   <empty> local-user remote-user terminal-type/speed
+	// Returns whatever followed the handshake.
+	if bytes.Count(b, []byte{0}) < 4 {
+		if len(b) > rloginMaxHandshake {
+			// Not an rlogin client, or not a friendly one
+			rlogin.fromClient <- ErrorMessage{Err: errors.New("rlogin handshake too long")}
+			rlogin.hungUp = true
+			rlogin.writeBuffer = make([]byte, 0)
+			rlogin.inboundConnection.ToConn() <- DisconnectMessage{}
+			return nil
+		}
+		rlogin.readBuffer = b
+		return nil
+	}
+
+	fields := bytes.SplitN(b, []byte{0}, 5)
+	if len(fields[0]) != 0 {
+		log.Print("rlogin handshake does not start with NUL")
+	}
+
+	msg := RloginHandshakeMessage{}
+	msg.LocalUser = string(fields[1])
+	msg.RemoteUser = string(fields[2])
+	msg.Term = string(fields[3])
+	i := strings.LastIndex(msg.Term, "/")
+	if i >= 0 {
+		speed, err := strconv.Atoi(msg.Term[i+1:])
+		if err == nil {
+			msg.Speed = speed
+		}
+		msg.Term = msg.Term[:i]
+	}
+	rlogin.handshakeDone = true
+
+	// Acknowledge the handshake, then ask for window sizes.
+	rlogin.inboundConnection.ToConn() <- NewDataMessage([]byte{0})
+	rlogin.inboundConnection.ToConn() <- UrgentDataMessage{Data: []byte{rloginUrgentWindow}}
+	rlogin.fromClient <- msg
+
+	if len(rlogin.writeBuffer) > 0 {
+		data := rlogin.writeBuffer
+		rlogin.writeBuffer = make([]byte, 0)
+		rlogin.inboundConnection.ToConn() <- NewDataMessage(data)
+	}
+
+	return fields[4]
+}
+
+func (rlogin *rloginFilter) processInboundData(b []byte) {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		if b[i] != 0xff {
+			out = append(out, b[i])
+			continue
+		}
+
+		rest := b[i:]
+		if len(rest) < len(rloginWindowCookie) && bytes.HasPrefix(rloginWindowCookie, rest) {
+			// Might be the start of a window size report
+			rlogin.readBuffer = append(rlogin.readBuffer, rest...)
+			break
+		} else if !bytes.HasPrefix(rest, rloginWindowCookie) {
+			out = append(out, b[i])
+			continue
+		}
+
+		if len(rest) < rloginWindowLength {
+			rlogin.readBuffer = append(rlogin.readBuffer, rest...)
+			break
+		}
+
+		// Keep data and window changes in order
+		if len(out) > 0 {
+			rlogin.fromClient <- NewDataMessage(out)
+			out = make([]byte, 0, len(b))
+		}
+		rows := binary.BigEndian.Uint16(rest[4:6])
+		cols := binary.BigEndian.Uint16(rest[6:8])
+		rlogin.fromClient <- WindowSizeMessage{Width: int(cols), Height: int(rows)}
+		i += rloginWindowLength - 1
+	}
+
+	if len(out) > 0 {
+		rlogin.fromClient <- NewDataMessage(out)
+	}
+}
+
+func (rlogin *rloginFilter) processToClient(m message) {
+	// The connection stops reading once we've hung up on it
+	if rlogin.hungUp {
+		return
+	}
+
+	if m.Type() != MTDataMessage {
+		rlogin.inboundConnection.ToConn() <- m
+		return
+	}
+
+	// Nothing can go to the client before we acknowledge the
+	// handshake.
+	if !rlogin.handshakeDone {
+		rlogin.writeBuffer = append(rlogin.writeBuffer, m.(DataMessage).Data...)
+		return
+	}
+
+	rlogin.inboundConnection.ToConn() <- m
+}
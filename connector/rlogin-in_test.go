@@ -0,0 +1,123 @@
+package connector
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRloginFilter(t *testing.T) {
+	t.Parallel()
+
+	dummy, err := NewDummyConnection("0")
+	assert.Equal(t, nil, err, "No dummy connection error")
+
+	rlogin, err := NewRloginFilter(dummy)
+	assert.Equal(t, nil, err, "No rlogin filter error")
+	assert.Equal(t, dummy.Id()+"-(rlogin)", rlogin.Id(), "Rlogin ID is proper")
+
+	// Output before the handshake is held back
+	rlogin.ToConn() <- NewDataMessageFromString("Welcome")
+
+	// Handshake, split across messages
+	dummy.Send(NewDataMessageFromString("\x00joel\x00"))
+	dummy.Send(NewDataMessageFromString("jmaslak\x00vt100/38400\x00Hi"))
+
+	o, ok := dummy.Recv()
+	assert.True(t, ok, "No dummy receive error")
+	assert.Equal(t, []byte{0}, o.(DataMessage).Data, "Handshake acknowledged")
+
+	o, ok = dummy.Recv()
+	assert.True(t, ok, "No dummy receive error")
+	assert.Equal(t, UrgentDataMessage{Data: []byte{0x80}}, o, "Window size requested")
+
+	m := <-rlogin.FromConn()
+	expected := RloginHandshakeMessage{LocalUser: "joel", RemoteUser: "jmaslak", Term: "vt100", Speed: 38400}
+	assert.Equal(t, expected, m, "Handshake parsed")
+
+	o, ok = dummy.Recv()
+	assert.True(t, ok, "No dummy receive error")
+	assert.Equal(t, "Welcome", o.(DataMessage).String(), "Held output sent")
+
+	m = <-rlogin.FromConn()
+	assert.Equal(t, "Hi", m.(DataMessage).String(), "Data after handshake")
+
+	// Window size report split across messages, with data around it
+	dummy.Send(NewDataMessage([]byte{'a', 0xff, 0xff}))
+	m = <-rlogin.FromConn()
+	assert.Equal(t, "a", m.(DataMessage).String(), "Data before report")
+	dummy.Send(NewDataMessage([]byte{'s', 's', 0, 24, 0, 80, 0, 0, 0, 0, 'b'}))
+	m = <-rlogin.FromConn()
+	assert.Equal(t, WindowSizeMessage{Width: 80, Height: 24}, m, "Window size parsed")
+	m = <-rlogin.FromConn()
+	assert.Equal(t, "b", m.(DataMessage).String(), "Data after report")
+
+	// 0xff that isn't a report is just data
+	dummy.Send(NewDataMessage([]byte{0xff, 'x'}))
+	m = <-rlogin.FromConn()
+	assert.Equal(t, []byte{0xff, 'x'}, m.(DataMessage).Data, "Plain 0xff passed")
+
+	rlogin.ToConn() <- NewDataMessageFromString("Foo")
+	o, ok = dummy.Recv()
+	assert.True(t, ok, "No dummy receive error")
+	assert.Equal(t, "Foo", o.(DataMessage).String(), "Output passed")
+}
+
+func TestRloginFilterHandshakeTooLong(t *testing.T) {
+	t.Parallel()
+
+	dummy, err := NewDummyConnection("0")
+	assert.Equal(t, nil, err, "No dummy connection error")
+
+	rlogin, err := NewRloginFilter(dummy)
+	assert.Equal(t, nil, err, "No rlogin filter error")
+
+	dummy.Send(NewDataMessageFromString(strings.Repeat("x", rloginMaxHandshake+1)))
+	m := <-rlogin.FromConn()
+	assert.IsType(t, ErrorMessage{}, m, "Error reported")
+
+	o, ok := dummy.Recv()
+	assert.True(t, ok, "No dummy receive error")
+	assert.Equal(t, DisconnectMessage{}, o, "Client disconnected")
+
+	// Anything else is dropped until the connection goes away
+	rlogin.ToConn() <- NewDataMessageFromString("Foo")
+	dummy.Send(NewDataMessageFromString("\x00joel\x00joel\x00xterm\x00"))
+	close(dummy.FromConn())
+	_, ok = <-rlogin.FromConn()
+	assert.False(t, ok, "Filter done")
+	_, ok = dummy.Recv()
+	assert.False(t, ok, "Connection closed")
+}
+
+func TestRloginListen(t *testing.T) {
+	t.Parallel()
+
+	listen, err := NewRloginListen("0", "127.0.0.1:0")
+	assert.Equal(t, nil, err, "Listener does not return error")
+	addr := listen.Addr.String()
+	assert.Equal(t, "0-RLOGIN-"+addr, listen.Id(), "Rlogin listener ID correct")
+
+	outbound, err := net.Dial("tcp", addr)
+	assert.Equal(t, nil, err, "Error from net.Dial()")
+	defer outbound.Close()
+
+	m := <-listen.Notify()
+	assert.IsType(t, NewConnectionMessage{}, m, "New connection message")
+	conn := m.(NewConnectionMessage).Conn
+	assert.IsType(t, rloginFilter{}, conn, "Connection is filtered")
+	assert.Equal(t, "0-RLOGIN-"+addr+"-"+outbound.LocalAddr().String()+"-(rlogin)", conn.Id(), "Connection ID correct")
+
+	outbound.Write([]byte("\x00joel\x00joel\x00xterm/9600\x00"))
+	m = <-conn.FromConn()
+	assert.Equal(t, "xterm", m.(RloginHandshakeMessage).Term, "Handshake received")
+
+	b := make([]byte, 1)
+	_, err = outbound.Read(b)
+	assert.Equal(t, nil, err, "Outbound read has no error")
+	assert.Equal(t, []byte{0}, b, "Handshake acknowledged")
+
+	close(conn.ToConn())
+}
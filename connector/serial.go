@@ -0,0 +1,129 @@
+package connector
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+)
+
+type SerialParity int
+
+const (
+	SerialParityNone SerialParity = iota
+	SerialParityEven
+	SerialParityOdd
+)
+
+type SerialFlowControl int
+
+const (
+	SerialFlowNone     SerialFlowControl = iota
+	SerialFlowHardware                   // RTS/CTS
+	SerialFlowSoftware                   // XON/XOFF
+)
+
+type SerialOptions struct {
+	Baud        int // Defaults to 9600
+	DataBits    int // 5 through 8, defaults to 8
+	Parity      SerialParity
+	StopBits    int // 1 or 2, defaults to 1
+	FlowControl SerialFlowControl
+}
+
+type serialConn struct {
+	id       string
+	device   string
+	port     *os.File
+	fromConn chan message
+	toConn   chan message
+}
+
+func (serial serialConn) Id() string             { return serial.id }
+func (serial serialConn) FromConn() chan message { return serial.fromConn }
+func (serial serialConn) ToConn() chan message   { return serial.toConn }
+func (serial serialConn) Device() string         { return serial.device }
+
+func NewSerialConnection(id string, device string, opts SerialOptions) (serialConn, error) {
+	serial := serialConn{}
+
+	if opts.Baud == 0 {
+		opts.Baud = 9600
+	}
+	if opts.DataBits == 0 {
+		opts.DataBits = 8
+	}
+	if opts.StopBits == 0 {
+		opts.StopBits = 1
+	}
+
+	port, err := openSerial(device, opts)
+	if err != nil {
+		return serial, err
+	}
+	serial.port = port
+	serial.device = device
+	serial.id = id + "-Serial-" + device
+	serial.fromConn = make(chan message)
+	serial.toConn = make(chan message)
+
+	go serial.connectionInputHandler()
+	go serial.connectionOutputHandler()
+
+	return serial, nil
+}
+
+func (serial *serialConn) connectionOutputHandler() {
+	defer close(serial.fromConn)
+
+	b := make([]byte, 65535)
+	n, err := io.ReadAtLeast(serial.port, b, 1)
+	for err == nil && n > 0 {
+		newSlice := make([]byte, n)
+		copy(newSlice, b[:n])
+		serial.fromConn <- DataMessage{Data: newSlice}
+		n, err = io.ReadAtLeast(serial.port, b, 1)
+	}
+
+	// Unlike a socket, a serial port never "ends" on its own, so
+	// EOF means the tty was hung up, typically because a USB
+	// adapter was unplugged.
+	if err == io.EOF {
+		err = errors.New(serial.device + " disconnected")
+	}
+	serial.fromConn <- ErrorMessage{Err: err}
+}
+
+func (serial *serialConn) connectionInputHandler() {
+	// If writing fails our user finds out from the output handler,
+	// and we don't want them stuck sending to us until then.
+	failed := false
+	defer func() {
+		if failed {
+			drainMessages(serial.toConn)
+		}
+	}()
+	defer serial.port.Close()
+	for {
+		m, ok := <-serial.toConn
+		if !ok {
+			return
+		}
+
+		switch m.(type) {
+		case DataMessage:
+			dataMsg := m.(DataMessage)
+			b := dataMsg.Data
+			n, err := serial.port.Write(b)
+			if err != nil || n != len(b) {
+				log.Print("Could not write full message to serial device")
+				failed = true
+				return
+			}
+		case DisconnectMessage:
+			return
+		default:
+			log.Print("Unknown message type: " + m.TypeString())
+		}
+	}
+}
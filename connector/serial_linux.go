@@ -0,0 +1,116 @@
+package connector
+
+import (
+	"errors"
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+var serialBaudRates = map[int]uint32{
+	50:      unix.B50,
+	75:      unix.B75,
+	110:     unix.B110,
+	134:     unix.B134,
+	150:     unix.B150,
+	200:     unix.B200,
+	300:     unix.B300,
+	600:     unix.B600,
+	1200:    unix.B1200,
+	1800:    unix.B1800,
+	2400:    unix.B2400,
+	4800:    unix.B4800,
+	9600:    unix.B9600,
+	19200:   unix.B19200,
+	38400:   unix.B38400,
+	57600:   unix.B57600,
+	115200:  unix.B115200,
+	230400:  unix.B230400,
+	460800:  unix.B460800,
+	921600:  unix.B921600,
+	1000000: unix.B1000000,
+}
+
+var serialDataBits = map[int]uint32{
+	5: unix.CS5,
+	6: unix.CS6,
+	7: unix.CS7,
+	8: unix.CS8,
+}
+
+func openSerial(device string, opts SerialOptions) (*os.File, error) {
+	// We open non-blocking so that Go's poller handles the reads,
+	// which lets a Close() interrupt a pending read.
+	fd, err := unix.Open(device, unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	err = configureSerial(fd, opts)
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	return os.NewFile(uintptr(fd), device), nil
+}
+
+func configureSerial(fd int, opts SerialOptions) error {
+	speed, ok := serialBaudRates[opts.Baud]
+	if !ok {
+		return errors.New("unsupported baud rate: " + strconv.Itoa(opts.Baud))
+	}
+	size, ok := serialDataBits[opts.DataBits]
+	if !ok {
+		return errors.New("unsupported data bits: " + strconv.Itoa(opts.DataBits))
+	}
+	if opts.StopBits != 1 && opts.StopBits != 2 {
+		return errors.New("unsupported stop bits: " + strconv.Itoa(opts.StopBits))
+	}
+
+	t, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return err
+	}
+
+	// Raw mode, the same as cfmakeraw(3)
+	t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR |
+		unix.ICRNL | unix.IXON | unix.IXOFF | unix.IXANY | unix.INPCK
+	t.Oflag &^= unix.OPOST
+	t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	t.Cflag &^= unix.CSIZE | unix.PARENB | unix.PARODD | unix.CSTOPB | unix.CRTSCTS | unix.CBAUD
+	t.Cflag |= unix.CLOCAL | unix.CREAD | size | speed
+	t.Ispeed = speed
+	t.Ospeed = speed
+	t.Cc[unix.VMIN] = 1
+	t.Cc[unix.VTIME] = 0
+
+	switch opts.Parity {
+	case SerialParityNone:
+	case SerialParityEven:
+		t.Cflag |= unix.PARENB
+		t.Iflag |= unix.INPCK
+	case SerialParityOdd:
+		t.Cflag |= unix.PARENB | unix.PARODD
+		t.Iflag |= unix.INPCK
+	default:
+		return errors.New("unsupported parity")
+	}
+
+	if opts.StopBits == 2 {
+		t.Cflag |= unix.CSTOPB
+	}
+
+	switch opts.FlowControl {
+	case SerialFlowNone:
+	case SerialFlowHardware:
+		t.Cflag |= unix.CRTSCTS
+	case SerialFlowSoftware:
+		t.Iflag |= unix.IXON | unix.IXOFF
+	default:
+		return errors.New("unsupported flow control")
+	}
+
+	return unix.IoctlSetTermios(fd, unix.TCSETS, t)
+}
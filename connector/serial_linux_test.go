@@ -0,0 +1,85 @@
+package connector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestSerialConnection(t *testing.T) {
+	t.Parallel()
+
+	// A pty pair stands in for the serial device, with the master
+	// playing the part of whatever is plugged into the port.
+	device, tty, err := pty.Open()
+	assert.Equal(t, nil, err, "Pty opened")
+	defer tty.Close()
+
+	opts := SerialOptions{
+		Baud:        19200,
+		DataBits:    8,
+		Parity:      SerialParityEven,
+		StopBits:    2,
+		FlowControl: SerialFlowHardware,
+	}
+	serial, err := NewSerialConnection("0", tty.Name(), opts)
+	assert.Equal(t, nil, err, "Serial connection opened")
+	assert.Equal(t, "0-Serial-"+tty.Name(), serial.Id(), "Serial ID correct")
+
+	termios, err := unix.IoctlGetTermios(int(tty.Fd()), unix.TCGETS)
+	assert.Equal(t, nil, err, "Termios read")
+	assert.Equal(t, uint32(unix.B19200), termios.Cflag&unix.CBAUD, "Baud rate set")
+	assert.Equal(t, uint32(unix.CS8), termios.Cflag&unix.CSIZE, "Data bits set")
+	// The pty driver won't store PARENB, so look for the input side
+	assert.NotEqual(t, uint32(0), termios.Iflag&unix.INPCK, "Parity checked")
+	assert.NotEqual(t, uint32(0), termios.Cflag&unix.CSTOPB, "Two stop bits")
+	assert.NotEqual(t, uint32(0), termios.Cflag&unix.CRTSCTS, "Hardware flow control")
+	assert.Equal(t, uint32(0), termios.Lflag&unix.ICANON, "Raw mode")
+	tty.Close()
+
+	device.Write([]byte("Hello"))
+	m := <-serial.FromConn()
+	assert.Equal(t, "Hello", m.(DataMessage).String(), "Data from device")
+
+	serial.ToConn() <- NewDataMessageFromString("Foo")
+	b := make([]byte, 65535)
+	n, err := device.Read(b)
+	assert.Equal(t, nil, err, "Device read has no error")
+	assert.Equal(t, "Foo", string(b[:n]), "Data to device")
+
+	// Unplug the device
+	device.Close()
+	m = <-serial.FromConn()
+	assert.IsType(t, ErrorMessage{}, m, "Error on device loss")
+
+	_, ok := <-serial.FromConn()
+	assert.False(t, ok, "Channel closed")
+
+	// Writing fails too, but mustn't leave us stuck
+	for i := 0; i < 2; i++ {
+		select {
+		case serial.ToConn() <- NewDataMessageFromString("Bar"):
+		case <-time.After(time.Second):
+			t.Fatal("Send blocked after write failure")
+		}
+	}
+	close(serial.ToConn())
+}
+
+func TestSerialConnectionBadOptions(t *testing.T) {
+	t.Parallel()
+
+	device, tty, err := pty.Open()
+	assert.Equal(t, nil, err, "Pty opened")
+	defer device.Close()
+	defer tty.Close()
+
+	_, err = NewSerialConnection("0", tty.Name(), SerialOptions{Baud: 12345})
+	assert.NotEqual(t, nil, err, "Bad baud rate rejected")
+
+	_, err = NewSerialConnection("0", tty.Name(), SerialOptions{StopBits: 3})
+	assert.NotEqual(t, nil, err, "Bad stop bits rejected")
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package connector
+
+import (
+	"errors"
+	"os"
+)
+
+func openSerial(device string, opts SerialOptions) (*os.File, error) {
+	return nil, errors.New("serial devices are not supported on this platform")
+}
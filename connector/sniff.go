@@ -0,0 +1,216 @@
+package connector
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+type SniffListenOptions struct {
+	Timeout time.Duration     // How long to wait for the client to speak first
+	Ssh     *SshListenOptions // SSH clients are turned away if nil
+}
+
+// What the first bytes from a client tell us about it
+var (
+	sniffTelnet = []byte{telnetIAC}
+	sniffHttp   = []byte("GET ")
+	sniffSsh    = []byte("SSH-2.0")
+)
+
+type sniffListen struct {
+	listenControl
+	opts        SniffListenOptions
+	ssh         sshListen
+	web         websocketListen
+	webListener *connListener
+	Addr        net.Addr
+}
+
+func (listen sniffListen) Id() string            { return listen.id }
+func (listen sniffListen) Control() chan message { return listen.control }
+func (listen sniffListen) Notify() chan message  { return listen.notify }
+
+func NewSniffListen(id string, addr string, opts SniffListenOptions) (sniffListen, error) {
+	// A listener that looks at what a new client sends first to
+	// decide how to talk to it.  Telnet clients get a telnet filter,
+	// web browsers get the websocket terminal, SSH clients get SSH,
+	// and anything else (including silence) gets a plain TCP
+	// connection.
+	listen := sniffListen{}
+	listen.opts = opts
+	if listen.opts.Timeout == 0 {
+		listen.opts.Timeout = 300 * time.Millisecond
+	}
+
+	if opts.Ssh != nil {
+		config, err := newSshServerConfig(*opts.Ssh)
+		if err != nil {
+			return listen, err
+		}
+		listen.ssh.config = config
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return listen, err
+	}
+	listen.listener = l
+	listen.Addr = l.Addr()
+	listen.id = id + "-SNIFF-" + listen.Addr.String()
+	listen.fillControlDefaults()
+
+	// The SSH and websocket listeners never listen themselves, we
+	// just hand them connections.
+	listen.ssh.id = listen.id
+	listen.ssh.notify = listen.notify
+
+	listen.webListener = newConnListener(listen.Addr)
+	listen.web.id = listen.id
+	listen.web.notify = listen.notify
+	listen.web.Addr = listen.Addr
+
+	go listen.web.serve(listen.webListener)
+	go listen.doListen()
+
+	return listen, nil
+}
+
+func (listen *sniffListen) doListen() {
+	defer listen.listener.Close()
+	defer listen.webListener.Close()
+	listen.acceptLoop(listen.dispatch, nil)
+}
+
+func (listen *sniffListen) dispatch(conn net.Conn) {
+	if listen.overLimit(conn) {
+		return
+	}
+
+	// Waiting for the client to speak can take a while, so don't
+	// hold up other connections.
+	go listen.sniff(listen.track(conn))
+}
+
+func (listen *sniffListen) sniff(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+
+	first, err := listen.peek(conn, reader, 1)
+	if err != nil {
+		log.Print(err)
+		conn.Close()
+		return
+	}
+	if len(first) == 0 {
+		// The client is waiting for us to speak first
+		listen.startTcp(conn, false)
+		return
+	}
+
+	// Whatever we read is still waiting for whoever handles the
+	// connection.
+	buffered := &bufferedConn{Conn: conn, reader: reader}
+
+	switch {
+	case bytes.HasPrefix(sniffTelnet, first):
+		listen.startTcp(buffered, true)
+	case bytes.HasPrefix(sniffHttp, first) && listen.hasPrefix(conn, reader, sniffHttp):
+		listen.webListener.hand(buffered)
+	case bytes.HasPrefix(sniffSsh, first) && listen.hasPrefix(conn, reader, sniffSsh):
+		if listen.ssh.config == nil {
+			log.Print("SSH not enabled, dropping " + conn.RemoteAddr().String())
+			conn.Close()
+			return
+		}
+		listen.ssh.handleConn(buffered)
+	default:
+		listen.startTcp(buffered, false)
+	}
+}
+
+func (listen *sniffListen) peek(conn net.Conn, reader *bufio.Reader, n int) ([]byte, error) {
+	// Returns up to n bytes from the client, or fewer if it stops
+	// talking before the timeout.
+	conn.SetReadDeadline(time.Now().Add(listen.opts.Timeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	b, err := reader.Peek(n)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return b, nil
+		}
+		return b, err
+	}
+	return b, nil
+}
+
+func (listen *sniffListen) hasPrefix(conn net.Conn, reader *bufio.Reader, prefix []byte) bool {
+	b, err := listen.peek(conn, reader, len(prefix))
+	return err == nil && bytes.Equal(b, prefix)
+}
+
+func (listen *sniffListen) startTcp(conn net.Conn, telnet bool) {
+	c := newTcpConn(listen.id+"-"+conn.RemoteAddr().String(), conn)
+
+	msg := NewConnectionMessage{}
+	msg.Conn = c
+	if telnet {
+		filter, err := NewTelnetFilter(c)
+		if err != nil {
+			log.Print(err)
+			conn.Close()
+			return
+		}
+		msg.Conn = filter
+	}
+	listen.notify <- msg
+
+	go c.connectionInputHandler()
+	go c.connectionOutputHandler()
+}
+
+// A net.Listener that hands out connections accepted elsewhere, so
+// that we can give them to an http.Server.
+type connListener struct {
+	addr  net.Addr
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newConnListener(addr net.Addr) *connListener {
+	l := connListener{}
+	l.addr = addr
+	l.conns = make(chan net.Conn)
+	l.done = make(chan struct{})
+	return &l
+}
+
+func (l *connListener) hand(conn net.Conn) {
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		conn.Close()
+	}
+}
+
+func (l *connListener) Addr() net.Addr { return l.addr }
+
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *connListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
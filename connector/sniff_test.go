@@ -0,0 +1,138 @@
+package connector
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func sniffTestListen(t *testing.T) sniffListen {
+	opts := SniffListenOptions{
+		Timeout: 50 * time.Millisecond,
+		Ssh:     &SshListenOptions{NoClientAuth: true},
+	}
+	listen, err := NewSniffListen("0", "127.0.0.1:0", opts)
+	assert.Equal(t, nil, err, "Listener does not return error")
+	assert.Equal(t, "0-SNIFF-"+listen.Addr.String(), listen.Id(), "Sniffing listener ID correct")
+	return listen
+}
+
+func sniffTestConnection(t *testing.T, listen sniffListen) Connection {
+	m := <-listen.Notify()
+	assert.IsType(t, NewConnectionMessage{}, m, "New connection message")
+	return m.(NewConnectionMessage).Conn
+}
+
+func TestSniffTelnet(t *testing.T) {
+	t.Parallel()
+
+	listen := sniffTestListen(t)
+	outbound, err := net.Dial("tcp", listen.Addr.String())
+	assert.Equal(t, nil, err, "Error from net.Dial()")
+	defer outbound.Close()
+
+	outbound.Write([]byte{255, 251, 24}) // WILL TERMINAL TYPE
+	conn := sniffTestConnection(t, listen)
+	assert.IsType(t, telnetFilter{}, conn, "Connection is telnet")
+
+	b := make([]byte, 1)
+	_, err = outbound.Read(b)
+	assert.Equal(t, nil, err, "Outbound read has no error")
+	assert.Equal(t, byte(255), b[0], "Telnet negotiation sent")
+	close(conn.ToConn())
+}
+
+func TestSniffRaw(t *testing.T) {
+	t.Parallel()
+
+	listen := sniffTestListen(t)
+
+	// Silence
+	silent, err := net.Dial("tcp", listen.Addr.String())
+	assert.Equal(t, nil, err, "Error from net.Dial()")
+	defer silent.Close()
+
+	conn := sniffTestConnection(t, listen)
+	assert.IsType(t, tcpConn{}, conn, "Silent connection is raw")
+	silent.Write([]byte("Hello"))
+	m := <-conn.FromConn()
+	assert.Equal(t, "Hello", m.(DataMessage).String(), "Data received")
+	close(conn.ToConn())
+
+	// Talking, but nothing we recognize, nor something that just
+	// starts out looking like it.
+	for _, s := range []string{"Hello", "GET"} {
+		talker, err := net.Dial("tcp", listen.Addr.String())
+		assert.Equal(t, nil, err, "Error from net.Dial()")
+		defer talker.Close()
+
+		talker.Write([]byte(s))
+		conn = sniffTestConnection(t, listen)
+		assert.IsType(t, tcpConn{}, conn, "Unknown talker is raw")
+		m = <-conn.FromConn()
+		assert.Equal(t, s, m.(DataMessage).String(), "Sniffed data still received")
+		close(conn.ToConn())
+	}
+}
+
+func TestSniffWebsocket(t *testing.T) {
+	t.Parallel()
+
+	listen := sniffTestListen(t)
+	addr := listen.Addr.String()
+
+	resp, err := http.Get("http://" + addr + "/")
+	assert.Equal(t, nil, err, "Terminal page fetched")
+	page, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, nil, err, "Terminal page read")
+	assert.Contains(t, string(page), "new WebSocket(", "Terminal page served")
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws://"+addr+"/ws", nil)
+	assert.Equal(t, nil, err, "Websocket dial does not return error")
+	defer ws.Close()
+
+	conn := sniffTestConnection(t, listen)
+	assert.IsType(t, websocketConn{}, conn, "Connection is a websocket")
+
+	ws.WriteMessage(websocket.BinaryMessage, []byte("Hello"))
+	m := <-conn.FromConn()
+	assert.Equal(t, "Hello", m.(DataMessage).String(), "Data received")
+	close(conn.ToConn())
+}
+
+func TestSniffSsh(t *testing.T) {
+	t.Parallel()
+
+	listen := sniffTestListen(t)
+
+	clientConfig := &ssh.ClientConfig{
+		User:            "joel",
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	client, err := ssh.Dial("tcp", listen.Addr.String(), clientConfig)
+	assert.Equal(t, nil, err, "SSH connection accepted")
+	defer client.Close()
+
+	session, err := client.NewSession()
+	assert.Equal(t, nil, err, "Session created")
+	stdin, err := session.StdinPipe()
+	assert.Equal(t, nil, err, "Stdin pipe created")
+	err = session.Shell()
+	assert.Equal(t, nil, err, "Shell request accepted")
+
+	conn := sniffTestConnection(t, listen)
+	assert.IsType(t, sshConn{}, conn, "Connection is SSH")
+	assert.Equal(t, "joel", conn.(sshConn).User(), "User is correct")
+
+	stdin.Write([]byte("Hello"))
+	m := <-conn.FromConn()
+	assert.Equal(t, "Hello", m.(DataMessage).String(), "Data received")
+	close(conn.ToConn())
+}
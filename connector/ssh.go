@@ -0,0 +1,344 @@
+package connector
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+type SshListenOptions struct {
+	HostKeyFile       string // Created with a new key if it does not exist
+	PasswordCallback  func(user string, password []byte) bool
+	PublicKeyCallback func(user string, key ssh.PublicKey) bool
+	NoClientAuth      bool // Allow clients in without any authentication
+}
+
+const sshHandshakeTimeout = 30 * time.Second
+
+type sshListen struct {
+	listenControl
+	config *ssh.ServerConfig
+	Addr   net.Addr
+}
+
+func (listen sshListen) Id() string            { return listen.id }
+func (listen sshListen) Control() chan message { return listen.control }
+func (listen sshListen) Notify() chan message  { return listen.notify }
+
+type sshConn struct {
+	id       string
+	user     string
+	term     string
+	remote   net.Addr
+	channel  ssh.Channel
+	fromConn chan message
+	toConn   chan message
+}
+
+func (c sshConn) Id() string             { return c.id }
+func (c sshConn) FromConn() chan message { return c.fromConn }
+func (c sshConn) ToConn() chan message   { return c.toConn }
+func (c sshConn) RemoteAddr() net.Addr   { return c.remote }
+func (c sshConn) User() string           { return c.user }
+func (c sshConn) Term() string           { return c.term }
+
+// Payloads of the SSH session requests we understand (RFC 4254)
+type sshPtyRequest struct {
+	Term    string
+	Columns uint32
+	Rows    uint32
+	Width   uint32
+	Height  uint32
+	Modes   string
+}
+
+type sshWindowChange struct {
+	Columns uint32
+	Rows    uint32
+	Width   uint32
+	Height  uint32
+}
+
+type sshExitStatus struct {
+	Status uint32
+}
+
+func NewSshListen(id string, addr string, opts SshListenOptions) (sshListen, error) {
+	listen := sshListen{}
+
+	config, err := newSshServerConfig(opts)
+	if err != nil {
+		return listen, err
+	}
+	listen.config = config
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return listen, err
+	}
+	listen.listener = l
+	listen.Addr = l.Addr()
+	listen.id = id + "-SSH-" + listen.Addr.String()
+	listen.fillControlDefaults()
+
+	go listen.doListen()
+
+	return listen, nil
+}
+
+func newSshServerConfig(opts SshListenOptions) (*ssh.ServerConfig, error) {
+	config := &ssh.ServerConfig{}
+	config.NoClientAuth = opts.NoClientAuth
+
+	if opts.PasswordCallback != nil {
+		config.PasswordCallback = func(meta ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if opts.PasswordCallback(meta.User(), password) {
+				return nil, nil
+			}
+			return nil, errors.New("password rejected for " + meta.User())
+		}
+	}
+	if opts.PublicKeyCallback != nil {
+		config.PublicKeyCallback = func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if opts.PublicKeyCallback(meta.User(), key) {
+				return nil, nil
+			}
+			return nil, errors.New("public key rejected for " + meta.User())
+		}
+	}
+
+	signer, err := loadSshHostKey(opts.HostKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	config.AddHostKey(signer)
+
+	return config, nil
+}
+
+func loadSshHostKey(filename string) (ssh.Signer, error) {
+	// We want the host key to survive restarts so clients don't
+	// complain about a changed key, so we generate one only when
+	// the file doesn't exist yet and then save it.  An empty
+	// filename gives an ephemeral key.
+	if filename != "" {
+		b, err := os.ReadFile(filename)
+		if err == nil {
+			return ssh.ParsePrivateKey(b)
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if filename != "" {
+		block, err := ssh.MarshalPrivateKey(key, "termnet host key")
+		if err != nil {
+			return nil, err
+		}
+		err = os.WriteFile(filename, pem.EncodeToMemory(block), 0600)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ssh.NewSignerFromKey(key)
+}
+
+func (listen *sshListen) doListen() {
+	defer listen.listener.Close()
+	listen.acceptLoop(listen.dispatch, nil)
+}
+
+func (listen *sshListen) dispatch(conn net.Conn) {
+	if listen.overLimit(conn) {
+		return
+	}
+
+	// The SSH handshake can take a while, so don't hold up other
+	// connections while doing it.
+	go listen.handleConn(listen.track(conn))
+}
+
+func (listen *sshListen) handleConn(conn net.Conn) {
+	// Don't let a client that never finishes the handshake hold on
+	// to the connection forever.
+	conn.SetDeadline(time.Now().Add(sshHandshakeTimeout))
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, listen.config)
+	if err != nil {
+		log.Print(err)
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	defer sconn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	// A single SSH connection can carry several sessions, each of
+	// which becomes its own Connection.
+	session := 0
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			log.Print(err)
+			continue
+		}
+
+		c := sshConn{}
+		c.channel = channel
+		c.user = sconn.User()
+		c.remote = sconn.RemoteAddr()
+		c.id = listen.id + "-" + c.user + "@" + c.remote.String() + "-" + strconv.Itoa(session)
+		c.fromConn = make(chan message)
+		c.toConn = make(chan message)
+		session++
+
+		go listen.handleSession(c, requests)
+	}
+}
+
+func (listen *sshListen) handleSession(c sshConn, requests <-chan *ssh.Request) {
+	// We process session requests until the client asks for a
+	// shell, at which point we hand the session to whoever is
+	// listening on Notify().  Window size changes after that are
+	// sent along as messages.
+	var size *WindowSizeMessage
+	started := false
+	outputDone := make(chan struct{}) // The app may stop reading after this
+
+	for req := range requests {
+		switch req.Type {
+		case "pty-req":
+			pty := sshPtyRequest{}
+			if ssh.Unmarshal(req.Payload, &pty) != nil || started {
+				req.Reply(false, nil)
+				continue
+			}
+			c.term = pty.Term
+			size = &WindowSizeMessage{Width: int(pty.Columns), Height: int(pty.Rows)}
+			req.Reply(true, nil)
+		case "window-change":
+			change := sshWindowChange{}
+			if ssh.Unmarshal(req.Payload, &change) != nil {
+				continue
+			}
+			size = &WindowSizeMessage{Width: int(change.Columns), Height: int(change.Rows)}
+			if !started {
+				continue
+			}
+			select {
+			case <-outputDone:
+				// Too late, as the app may have stopped reading
+			default:
+				select {
+				case c.fromConn <- *size:
+				case <-outputDone:
+				}
+			}
+		case "shell":
+			if started {
+				req.Reply(false, nil)
+				continue
+			}
+			started = true
+			req.Reply(true, nil)
+
+			msg := NewConnectionMessage{}
+			msg.Conn = c
+			listen.notify <- msg
+
+			if size != nil {
+				c.fromConn <- *size
+			}
+
+			go func() {
+				defer close(outputDone)
+				c.connectionOutputHandler()
+			}()
+			go c.connectionInputHandler()
+		default:
+			// We don't support exec, subsystems, env, etc.
+			req.Reply(false, nil)
+		}
+	}
+
+	if !started {
+		c.channel.Close()
+		return
+	}
+
+	<-outputDone
+	close(c.fromConn)
+}
+
+func (c *sshConn) connectionOutputHandler() {
+	b := make([]byte, 32768) // Default SSH maximum packet data size
+	n, err := io.ReadAtLeast(c.channel, b, 1)
+	for err == nil && n > 0 {
+		newSlice := make([]byte, n)
+		copy(newSlice, b[:n])
+		c.fromConn <- DataMessage{Data: newSlice}
+		n, err = io.ReadAtLeast(c.channel, b, 1)
+	}
+	if err != nil {
+		if err == io.EOF {
+			c.fromConn <- DisconnectMessage{}
+		} else {
+			c.fromConn <- ErrorMessage{Err: err}
+		}
+	}
+}
+
+func (c *sshConn) connectionInputHandler() {
+	// If writing fails our user finds out from the output handler,
+	// and we don't want them stuck sending to us until then.
+	failed := false
+	defer func() {
+		if failed {
+			drainMessages(c.toConn)
+		}
+	}()
+	defer c.channel.Close()
+	defer c.channel.SendRequest("exit-status", false, ssh.Marshal(sshExitStatus{}))
+	for {
+		m, ok := <-c.toConn
+		if !ok {
+			return
+		}
+
+		switch m.(type) {
+		case DataMessage:
+			dataMsg := m.(DataMessage)
+			b := dataMsg.Data
+			n, err := c.channel.Write(b)
+			if err != nil || n != len(b) {
+				log.Print("Could not write full message out of SSH channel")
+				failed = true
+				return
+			}
+		case DisconnectMessage:
+			return
+		default:
+			log.Print("Unknown message type: " + m.TypeString())
+		}
+	}
+}
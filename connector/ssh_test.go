@@ -0,0 +1,159 @@
+package connector
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSshListen(t *testing.T) {
+	t.Parallel()
+
+	keyFile := filepath.Join(t.TempDir(), "host_key")
+	opts := SshListenOptions{
+		HostKeyFile: keyFile,
+		PasswordCallback: func(user string, password []byte) bool {
+			return user == "joel" && string(password) == "secret"
+		},
+	}
+
+	listen, err := NewSshListen("0", "127.0.0.1:0", opts)
+	assert.Equal(t, nil, err, "Listener does not return error")
+
+	addr := listen.Addr.String()
+	assert.Equal(t, "0-SSH-"+addr, listen.Id(), "SSH listener ID correct")
+
+	_, err = os.Stat(keyFile)
+	assert.Equal(t, nil, err, "Host key was saved")
+
+	var hostKey ssh.PublicKey
+	clientConfig := &ssh.ClientConfig{
+		User: "joel",
+		Auth: []ssh.AuthMethod{ssh.Password("wrong")},
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			hostKey = key
+			return nil
+		},
+	}
+	_, err = ssh.Dial("tcp", addr, clientConfig)
+	assert.NotEqual(t, nil, err, "Bad password is rejected")
+
+	clientConfig.Auth = []ssh.AuthMethod{ssh.Password("secret")}
+	client, err := ssh.Dial("tcp", addr, clientConfig)
+	assert.Equal(t, nil, err, "Good password is accepted")
+	defer client.Close()
+
+	session, err := client.NewSession()
+	assert.Equal(t, nil, err, "Session created")
+	err = session.RequestPty("vt100", 24, 80, ssh.TerminalModes{})
+	assert.Equal(t, nil, err, "PTY request accepted")
+	stdin, err := session.StdinPipe()
+	assert.Equal(t, nil, err, "Stdin pipe created")
+	stdout, err := session.StdoutPipe()
+	assert.Equal(t, nil, err, "Stdout pipe created")
+	err = session.Shell()
+	assert.Equal(t, nil, err, "Shell request accepted")
+
+	m := <-listen.Notify()
+	assert.IsType(t, NewConnectionMessage{}, m, "New connection message")
+	conn := m.(NewConnectionMessage).Conn
+	assert.IsType(t, sshConn{}, conn, "Connection is SSH")
+	assert.Equal(t, "joel", conn.(sshConn).User(), "User is correct")
+	assert.Equal(t, "vt100", conn.(sshConn).Term(), "Term is correct")
+
+	m = <-conn.FromConn()
+	assert.Equal(t, WindowSizeMessage{Width: 80, Height: 24}, m, "Initial window size")
+
+	stdin.Write([]byte("Hello"))
+	m = <-conn.FromConn()
+	assert.Equal(t, "Hello", m.(DataMessage).String(), "Data received")
+
+	conn.ToConn() <- NewDataMessageFromString("Foo")
+	b := make([]byte, 3)
+	_, err = io.ReadFull(stdout, b)
+	assert.Equal(t, nil, err, "Outbound read has no error")
+	assert.Equal(t, "Foo", string(b), "Foo is returned")
+
+	err = session.WindowChange(50, 132)
+	assert.Equal(t, nil, err, "Window change sent")
+	m = <-conn.FromConn()
+	assert.Equal(t, WindowSizeMessage{Width: 132, Height: 50}, m, "Changed window size")
+
+	stdin.Close()
+	m = <-conn.FromConn()
+	assert.IsType(t, DisconnectMessage{}, m, "Disconnect received")
+
+	// Nobody reads after that, so a late resize goes nowhere
+	err = session.WindowChange(60, 100)
+	assert.Equal(t, nil, err, "Late window change sent")
+	session.Close()
+
+	_, ok := <-conn.FromConn()
+	assert.False(t, ok, "Channel closed")
+
+	// Writing to the closed channel fails, but mustn't leave us stuck
+	for i := 0; i < 2; i++ {
+		select {
+		case conn.ToConn() <- NewDataMessageFromString("Bar"):
+		case <-time.After(time.Second):
+			t.Fatal("Send blocked after write failure")
+		}
+	}
+	close(conn.ToConn())
+
+	// A second listener with the same key file should present the
+	// same host key.
+	listen2, err := NewSshListen("0", "127.0.0.1:0", opts)
+	assert.Equal(t, nil, err, "Second listener does not return error")
+	firstKey := hostKey
+	client2, err := ssh.Dial("tcp", listen2.Addr.String(), clientConfig)
+	assert.Equal(t, nil, err, "Second listener accepts password")
+	client2.Close()
+	assert.Equal(t, firstKey.Marshal(), hostKey.Marshal(), "Host key persisted")
+}
+
+func TestSshListenPublicKey(t *testing.T) {
+	t.Parallel()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.Equal(t, nil, err, "Client key generated")
+	signer, err := ssh.NewSignerFromKey(key)
+	assert.Equal(t, nil, err, "Client signer created")
+
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Equal(t, nil, err, "Other key generated")
+	otherSigner, err := ssh.NewSignerFromKey(otherKey)
+	assert.Equal(t, nil, err, "Other signer created")
+
+	opts := SshListenOptions{
+		PublicKeyCallback: func(user string, key ssh.PublicKey) bool {
+			return user == "joel" && bytes.Equal(key.Marshal(), signer.PublicKey().Marshal())
+		},
+	}
+	listen, err := NewSshListen("0", "127.0.0.1:0", opts)
+	assert.Equal(t, nil, err, "Listener does not return error")
+
+	clientConfig := &ssh.ClientConfig{
+		User:            "joel",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(otherSigner)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	}
+	_, err = ssh.Dial("tcp", listen.Addr.String(), clientConfig)
+	assert.NotEqual(t, nil, err, "Unknown key is rejected")
+
+	clientConfig.Auth = []ssh.AuthMethod{ssh.PublicKeys(signer)}
+	client, err := ssh.Dial("tcp", listen.Addr.String(), clientConfig)
+	assert.Equal(t, nil, err, "Known key is accepted")
+	if client != nil {
+		client.Close()
+	}
+}
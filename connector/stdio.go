@@ -0,0 +1,176 @@
+package connector
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// Typing this on the terminal disconnects, as raw mode means ^C no
+// longer interrupts us.  It's the same escape character telnet uses.
+const stdioEscape byte = 0x1d // ^]
+
+type stdioConn struct {
+	id       string
+	in       *os.File
+	out      *os.File
+	state    *term.State // Terminal settings to restore, nil if not a terminal
+	restore  *sync.Once
+	done     chan struct{}
+	winch    chan os.Signal
+	fromConn chan message
+	toConn   chan message
+}
+
+func (stdio stdioConn) Id() string             { return stdio.id }
+func (stdio stdioConn) FromConn() chan message { return stdio.fromConn }
+func (stdio stdioConn) ToConn() chan message   { return stdio.toConn }
+func (stdio stdioConn) Done() chan struct{}    { return stdio.done }
+
+func NewStdioConnection(id string) (stdioConn, error) {
+	return newStdioConnection(id, os.Stdin, os.Stdout)
+}
+
+func newStdioConnection(id string, in *os.File, out *os.File) (stdioConn, error) {
+	stdio := stdioConn{}
+
+	stdio.id = id + "-Stdio"
+	stdio.in = in
+	stdio.out = out
+	stdio.restore = &sync.Once{}
+	stdio.done = make(chan struct{})
+	stdio.fromConn = make(chan message)
+	stdio.toConn = make(chan message)
+
+	// If we aren't on a terminal (for instance, input is a pipe)
+	// there's no terminal mode or window size to deal with.
+	if term.IsTerminal(int(in.Fd())) {
+		state, err := term.MakeRaw(int(in.Fd()))
+		if err != nil {
+			return stdio, err
+		}
+		stdio.state = state
+		stdio.winch = make(chan os.Signal, 1)
+		notifyWindowChange(stdio.winch)
+	}
+
+	go stdio.connectionInputHandler()
+	go stdio.connectionOutputHandler()
+
+	return stdio, nil
+}
+
+func (stdio stdioConn) Restore() {
+	// Puts the terminal back the way we found it.  This happens
+	// automatically when the connection is closed, but should also
+	// be called by anyone exiting the program while we're running.
+	// Done() is closed once it has happened.
+	stdio.restore.Do(func() {
+		if stdio.state != nil {
+			stopWindowChange(stdio.winch)
+			term.Restore(int(stdio.in.Fd()), stdio.state)
+		}
+		close(stdio.done)
+	})
+}
+
+func (stdio *stdioConn) windowSize() (WindowSizeMessage, bool) {
+	width, height, err := term.GetSize(int(stdio.in.Fd()))
+	if err != nil {
+		return WindowSizeMessage{}, false
+	}
+
+	return WindowSizeMessage{Width: width, Height: height}, true
+}
+
+func (stdio *stdioConn) connectionOutputHandler() {
+	defer close(stdio.fromConn)
+
+	if stdio.state != nil {
+		size, ok := stdio.windowSize()
+		if ok {
+			stdio.fromConn <- size
+		}
+	}
+
+	data := make(chan message)
+	go stdio.readInput(data)
+
+	for {
+		select {
+		case m, ok := <-data:
+			if !ok {
+				return
+			}
+			stdio.fromConn <- m
+		case <-stdio.winch:
+			size, ok := stdio.windowSize()
+			if ok {
+				stdio.fromConn <- size
+			}
+		}
+	}
+}
+
+func (stdio *stdioConn) readInput(data chan message) {
+	defer close(data)
+
+	b := make([]byte, 65535)
+	n, err := io.ReadAtLeast(stdio.in, b, 1)
+	for err == nil && n > 0 {
+		escape := -1
+		if stdio.state != nil {
+			escape = bytes.IndexByte(b[:n], stdioEscape)
+		}
+		if escape >= 0 {
+			// Whatever came before the escape still goes out
+			n = escape
+		}
+		if n > 0 {
+			newSlice := make([]byte, n)
+			copy(newSlice, b[:n])
+			data <- DataMessage{Data: newSlice}
+		}
+		if escape >= 0 {
+			data <- DisconnectMessage{}
+			return
+		}
+		n, err = io.ReadAtLeast(stdio.in, b, 1)
+	}
+	if err != nil {
+		if err == io.EOF {
+			data <- DisconnectMessage{}
+		} else {
+			data <- ErrorMessage{Err: err}
+		}
+	}
+}
+
+func (stdio *stdioConn) connectionInputHandler() {
+	defer stdio.Restore()
+	for {
+		m, ok := <-stdio.toConn
+		if !ok {
+			return
+		}
+
+		switch m.(type) {
+		case DataMessage:
+			dataMsg := m.(DataMessage)
+			b := dataMsg.Data
+			n, err := stdio.out.Write(b)
+			if err != nil || n != len(b) {
+				log.Print("Could not write full message to stdout")
+				return
+			}
+		case DisconnectMessage:
+			return
+		default:
+			log.Print("Unknown message type: " + m.TypeString())
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package connector
+
+import (
+	"os"
+)
+
+// There's no SIGWINCH here, so we only learn the window size when the
+// connection starts.
+func notifyWindowChange(c chan os.Signal) {}
+func stopWindowChange(c chan os.Signal)   {}
@@ -0,0 +1,95 @@
+//go:build linux
+
+package connector
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/creack/pty"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestStdioConnection(t *testing.T) {
+	t.Parallel()
+
+	// The pty slave plays the part of our controlling terminal.
+	console, tty, err := pty.Open()
+	assert.Equal(t, nil, err, "Pty opened")
+	defer console.Close()
+	defer tty.Close()
+	pty.Setsize(tty, &pty.Winsize{Cols: 80, Rows: 24})
+
+	stdio, err := newStdioConnection("0", tty, tty)
+	assert.Equal(t, nil, err, "Stdio connection created")
+	assert.Equal(t, "0-Stdio", stdio.Id(), "Stdio ID correct")
+
+	termios, err := unix.IoctlGetTermios(int(tty.Fd()), unix.TCGETS)
+	assert.Equal(t, nil, err, "Termios read")
+	assert.Equal(t, uint32(0), termios.Lflag&(unix.ICANON|unix.ECHO), "Raw mode set")
+
+	m := <-stdio.FromConn()
+	assert.Equal(t, WindowSizeMessage{Width: 80, Height: 24}, m, "Initial window size")
+
+	pty.Setsize(tty, &pty.Winsize{Cols: 132, Rows: 50})
+	syscall.Kill(os.Getpid(), syscall.SIGWINCH)
+	m = <-stdio.FromConn()
+	assert.Equal(t, WindowSizeMessage{Width: 132, Height: 50}, m, "Changed window size")
+
+	console.Write([]byte("Hello"))
+	m = <-stdio.FromConn()
+	assert.Equal(t, "Hello", m.(DataMessage).String(), "Data from terminal")
+
+	stdio.ToConn() <- NewDataMessageFromString("Foo")
+	b := make([]byte, 65535)
+	n, err := console.Read(b)
+	assert.Equal(t, nil, err, "Terminal read has no error")
+	assert.Equal(t, "Foo", string(b[:n]), "Data to terminal")
+
+	console.Write([]byte{'x', stdioEscape, 'y'})
+	m = <-stdio.FromConn()
+	assert.Equal(t, "x", m.(DataMessage).String(), "Data before escape")
+	m = <-stdio.FromConn()
+	assert.IsType(t, DisconnectMessage{}, m, "Escape disconnects")
+
+	close(stdio.ToConn())
+	<-stdio.Done()
+	stdio.Restore() // Safe to call again
+	termios, err = unix.IoctlGetTermios(int(tty.Fd()), unix.TCGETS)
+	assert.Equal(t, nil, err, "Termios read")
+	assert.NotEqual(t, uint32(0), termios.Lflag&unix.ICANON, "Terminal restored")
+}
+
+func TestStdioConnectionPipe(t *testing.T) {
+	t.Parallel()
+
+	inRead, inWrite, err := os.Pipe()
+	assert.Equal(t, nil, err, "Pipe created")
+	outRead, outWrite, err := os.Pipe()
+	assert.Equal(t, nil, err, "Pipe created")
+
+	stdio, err := newStdioConnection("0", inRead, outWrite)
+	assert.Equal(t, nil, err, "Stdio connection created without a terminal")
+
+	inWrite.Write([]byte("Hello"))
+	m := <-stdio.FromConn()
+	assert.Equal(t, "Hello", m.(DataMessage).String(), "Data from pipe")
+
+	stdio.ToConn() <- NewDataMessageFromString("Foo")
+	b := make([]byte, 3)
+	n, err := outRead.Read(b)
+	assert.Equal(t, nil, err, "Pipe read has no error")
+	assert.Equal(t, "Foo", string(b[:n]), "Data to pipe")
+
+	inWrite.Write([]byte{stdioEscape})
+	m = <-stdio.FromConn()
+	assert.Equal(t, []byte{stdioEscape}, m.(DataMessage).Data, "No escape without a terminal")
+
+	inWrite.Close()
+	m = <-stdio.FromConn()
+	assert.IsType(t, DisconnectMessage{}, m, "Disconnect at end of input")
+	close(stdio.ToConn())
+	<-stdio.Done()
+}
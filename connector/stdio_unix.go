@@ -0,0 +1,17 @@
+//go:build unix
+
+package connector
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func notifyWindowChange(c chan os.Signal) {
+	signal.Notify(c, syscall.SIGWINCH)
+}
+
+func stopWindowChange(c chan os.Signal) {
+	signal.Stop(c)
+}
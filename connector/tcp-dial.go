@@ -0,0 +1,187 @@
+package connector
+
+import (
+	"net"
+	"time"
+)
+
+type TcpDialOptions struct {
+	Reconnect      bool          // Reconnect when the far end goes away
+	MaxRetries     int           // Failed reconnects before giving up (0 is forever)
+	InitialBackoff time.Duration // Wait before the first reconnect attempt
+	MaxBackoff     time.Duration // Longest wait between reconnect attempts
+	DialTimeout    time.Duration
+	Proxy          DialProxy // Reach the far end through a SOCKS5 or HTTP proxy
+	Timeouts       TcpTimeouts
+	HalfClose      bool // Send InputEndedMessage, not DisconnectMessage, when the far end stops sending
+}
+
+type tcpDial struct {
+	id       string
+	addr     string
+	opts     TcpDialOptions
+	fromConn chan message
+	toConn   chan message
+}
+
+func (dial tcpDial) Id() string             { return dial.id }
+func (dial tcpDial) FromConn() chan message { return dial.fromConn }
+func (dial tcpDial) ToConn() chan message   { return dial.toConn }
+
+func NewTcpDial(id string, addr string, opts TcpDialOptions) (tcpDial, error) {
+	dial := tcpDial{}
+
+	dial.id = id + "-TCPDial-" + addr
+	dial.addr = addr
+	dial.opts = opts
+	dial.fillDefaults()
+
+	conn, err := dialTcp(addr, dial.opts.Proxy, dial.opts.DialTimeout)
+	if err != nil {
+		return dial, err
+	}
+
+	go dial.doDial(conn)
+
+	return dial, nil
+}
+
+func (dial *tcpDial) fillDefaults() {
+	dial.fromConn = make(chan message)
+	dial.toConn = make(chan message)
+	if dial.opts.InitialBackoff == 0 {
+		dial.opts.InitialBackoff = time.Second
+	}
+	if dial.opts.MaxBackoff == 0 {
+		dial.opts.MaxBackoff = time.Minute
+	}
+	if dial.opts.DialTimeout == 0 {
+		dial.opts.DialTimeout = 30 * time.Second
+	}
+}
+
+func (dial *tcpDial) doDial(conn net.Conn) {
+	defer close(dial.fromConn)
+
+	for {
+		c := newTcpConn(dial.id, conn)
+		c.timeouts = dial.opts.Timeouts
+		c.halfClose = dial.opts.HalfClose
+		c.setKeepAlive()
+		go c.connectionInputHandler()
+		go c.connectionOutputHandler()
+
+		if !dial.relay(c) || !dial.opts.Reconnect {
+			return
+		}
+
+		conn = dial.redial()
+		if conn == nil {
+			return
+		}
+	}
+}
+
+func (dial *tcpDial) relay(c tcpConn) bool {
+	// Shuffles messages between our user and the current TCP
+	// connection.  Returns true if the far end went away, or false
+	// if our user is done with us.
+	var pending message
+	for {
+		// Only accept a new message from our user once the
+		// previous one has been taken by the TCP connection.
+		in := dial.toConn
+		var out chan message
+		if pending != nil {
+			in = nil
+			out = c.toConn
+		}
+
+		select {
+		case m, ok := <-c.fromConn:
+			if !ok {
+				close(c.toConn)
+				return true
+			}
+			dial.fromConn <- m
+		case out <- pending:
+			if pending.Type() == MTDisconnectMessage {
+				close(c.toConn)
+				drainMessages(c.fromConn)
+				return false
+			}
+			pending = nil
+		case m, ok := <-in:
+			if !ok {
+				close(c.toConn)
+				drainMessages(c.fromConn)
+				return false
+			}
+			pending = m
+		}
+	}
+}
+
+func (dial *tcpDial) redial() net.Conn {
+	// Tries to get a new connection to the far end, backing off
+	// exponentially between attempts.  Returns nil if we gave up or
+	// our user went away while we were waiting.
+	backoff := dial.opts.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		timer := time.NewTimer(backoff)
+		if !dial.waitFor(timer.C) {
+			timer.Stop()
+			return nil
+		}
+
+		conn, err := dialTcp(dial.addr, dial.opts.Proxy, dial.opts.DialTimeout)
+		if err == nil {
+			return conn
+		}
+		if !dial.send(ErrorMessage{Err: err}) {
+			return nil
+		}
+
+		if dial.opts.MaxRetries > 0 && attempt >= dial.opts.MaxRetries {
+			return nil
+		}
+
+		backoff *= 2
+		if backoff > dial.opts.MaxBackoff {
+			backoff = dial.opts.MaxBackoff
+		}
+	}
+}
+
+func (dial *tcpDial) waitFor(c <-chan time.Time) bool {
+	// While we're not connected anything our user sends is thrown
+	// away, although we still notice if they are done with us.
+	for {
+		select {
+		case <-c:
+			return true
+		case m, ok := <-dial.toConn:
+			if !ok || m.Type() == MTDisconnectMessage {
+				return false
+			}
+		}
+	}
+}
+
+func (dial *tcpDial) send(m message) bool {
+	for {
+		select {
+		case dial.fromConn <- m:
+			return true
+		case m, ok := <-dial.toConn:
+			if !ok || m.Type() == MTDisconnectMessage {
+				return false
+			}
+		}
+	}
+}
+
+func drainMessages(c chan message) {
+	for range c {
+	}
+}
@@ -0,0 +1,99 @@
+package connector
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTcpDial(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, nil, err, "Listen does not return error")
+	defer l.Close()
+	addr := l.Addr().String()
+
+	dial, err := NewTcpDial("0", addr, TcpDialOptions{})
+	assert.Equal(t, nil, err, "Dial does not return error")
+	assert.Equal(t, "0-TCPDial-"+addr, dial.Id(), "Dial ID correct")
+
+	server, err := l.Accept()
+	assert.Equal(t, nil, err, "Accept does not return error")
+
+	server.Write([]byte("Hello"))
+	m, ok := <-dial.FromConn()
+	assert.True(t, ok, "Channel open")
+	assert.Equal(t, "Hello", m.(DataMessage).String())
+
+	dial.ToConn() <- NewDataMessageFromString("Foo")
+	b := make([]byte, 65535)
+	n, err := server.Read(b)
+	assert.Equal(t, nil, err, "Server read has no error")
+	assert.Equal(t, "Foo", string(b[:n]), "Foo is returned")
+
+	server.Close()
+	m, ok = <-dial.FromConn()
+	assert.True(t, ok, "Channel open")
+	assert.IsType(t, DisconnectMessage{}, m, "Disconnect received")
+
+	_, ok = <-dial.FromConn()
+	assert.False(t, ok, "Channel closed without reconnect")
+	close(dial.ToConn())
+}
+
+func TestTcpDialReconnect(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, nil, err, "Listen does not return error")
+	addr := l.Addr().String()
+
+	opts := TcpDialOptions{
+		Reconnect:      true,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     20 * time.Millisecond,
+	}
+	dial, err := NewTcpDial("0", addr, opts)
+	assert.Equal(t, nil, err, "Dial does not return error")
+
+	server, err := l.Accept()
+	assert.Equal(t, nil, err, "Accept does not return error")
+	server.Close()
+
+	m := <-dial.FromConn()
+	assert.IsType(t, DisconnectMessage{}, m, "Disconnect received")
+
+	server, err = l.Accept()
+	assert.Equal(t, nil, err, "Accept of reconnection does not return error")
+
+	server.Write([]byte("Hello"))
+	m = <-dial.FromConn()
+	assert.Equal(t, "Hello", m.(DataMessage).String(), "Data after reconnect")
+
+	// Now make reconnection impossible
+	server.Close()
+	l.Close()
+
+	m = <-dial.FromConn()
+	assert.IsType(t, DisconnectMessage{}, m, "Disconnect received")
+	m = <-dial.FromConn()
+	assert.IsType(t, ErrorMessage{}, m, "Reconnect failure reported")
+
+	close(dial.ToConn())
+	drainMessages(dial.FromConn())
+}
+
+func TestTcpDialFailure(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, nil, err, "Listen does not return error")
+	addr := l.Addr().String()
+	l.Close()
+
+	_, err = NewTcpDial("0", addr, TcpDialOptions{})
+	assert.NotEqual(t, nil, err, "Dial to closed port returns error")
+}
@@ -0,0 +1,27 @@
+package connector
+
+import (
+	"net"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func setKeepAliveInterval(tcp *net.TCPConn, interval time.Duration) error {
+	// Newer Go only sets the idle time before the first probe, and
+	// leaves the gap between probes at the system default.
+	raw, err := tcp.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	seconds := int((interval + time.Second - 1) / time.Second)
+	var optErr error
+	err = raw.Control(func(fd uintptr) {
+		optErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_KEEPINTVL, seconds)
+	})
+	if err != nil {
+		return err
+	}
+	return optErr
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package connector
+
+import (
+	"net"
+	"time"
+)
+
+func setKeepAliveInterval(tcp *net.TCPConn, interval time.Duration) error {
+	// SetKeepAlivePeriod is as close as we can portably get
+	return nil
+}
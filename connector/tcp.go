@@ -1,17 +1,39 @@
 package connector
 
 import (
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
 	"io"
 	"log"
 	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
+type TcpListenOptions struct {
+	ProxyProtocol bool         // Expect a PROXY protocol v1 or v2 header
+	ProxyTrusted  []*net.IPNet // Sources allowed to send PROXY headers
+	Timeouts      TcpTimeouts
+	HalfClose     bool // Send InputEndedMessage, not DisconnectMessage, when the client stops sending
+}
+
+// When to give up on a connection whose far end has gone quiet.  A
+// read idle timeout ends with a DisconnectMessage, the others with an
+// ErrorMessage, each with the reason set.
+type TcpTimeouts struct {
+	KeepAlive    time.Duration // Keepalive probe interval (0 is the system default, negative is off)
+	ReadIdle     time.Duration // Hang up if nothing is heard for this long (0 is forever)
+	WriteTimeout time.Duration // Hang up if a write takes this long (0 is forever)
+}
+
 type tcpListen struct {
-	id       string
-	listener net.Listener
-	Addr     net.Addr
-	control  chan message
-	notify   chan message
+	listenControl
+	opts TcpListenOptions
+	Addr net.Addr
 }
 
 func (listen tcpListen) Id() string            { return listen.id }
@@ -19,81 +41,288 @@ func (listen tcpListen) Control() chan message { return listen.control }
 func (listen tcpListen) Notify() chan message  { return listen.notify }
 
 type tcpConn struct {
-	id       string
-	conn     net.Conn
-	fromConn chan message
-	toConn   chan message
+	id            string
+	conn          net.Conn
+	tracker       *connTracker // Nil if we didn't come from a listener
+	timeouts      TcpTimeouts
+	halfClose     bool
+	writeTimedOut chan struct{} // Closed if the input handler gave up writing
+	inputDone     chan struct{} // Closed once the input handler stops writing
+	fromConn      chan message
+	toConn        chan message
+	attributes    *ConnAttributes
 }
 
-func (tcp tcpConn) Id() string             { return tcp.id }
-func (tcp tcpConn) FromConn() chan message { return tcp.fromConn }
-func (tcp tcpConn) ToConn() chan message   { return tcp.toConn }
-func (tcp tcpConn) RemoteAddr() net.Addr   { return tcp.conn.RemoteAddr() }
+func (tcp tcpConn) Id() string                  { return tcp.id }
+func (tcp tcpConn) FromConn() chan message      { return tcp.fromConn }
+func (tcp tcpConn) ToConn() chan message        { return tcp.toConn }
+func (tcp tcpConn) RemoteAddr() net.Addr        { return tcp.conn.RemoteAddr() }
+func (tcp tcpConn) Attributes() *ConnAttributes { return tcp.attributes }
 
 func NewTcpListen(id string, addr string) (tcpListen, error) {
+	return NewTcpListenWithOptions(id, addr, TcpListenOptions{})
+}
+
+func NewTcpListenWithOptions(id string, addr string, opts TcpListenOptions) (tcpListen, error) {
+	return newTcpListen(id, "tcp", addr, opts)
+}
+
+func newTcpListen(id string, network string, addr string, opts TcpListenOptions) (tcpListen, error) {
 	listen := tcpListen{}
 
-	l, err := net.Listen("tcp", addr)
+	if opts.ProxyProtocol && len(opts.ProxyTrusted) == 0 {
+		return listen, errors.New("PROXY protocol requires trusted sources")
+	}
+	listen.opts = opts
+
+	l, err := net.Listen(network, addr)
 	if err != nil {
 		return listen, err
 	}
 	listen.listener = l
 	listen.Addr = l.Addr()
 	listen.id = id + "-TCP-" + listen.Addr.String()
-	listen.control = make(chan message)
-	listen.notify = make(chan message)
+	listen.fillDefaults()
 
 	go listen.doListen()
 
 	return listen, nil
 }
 
+func (listen *tcpListen) fillDefaults() {
+	listen.fillControlDefaults()
+	listen.ready = make(chan net.Conn)
+}
+
 func (listen *tcpListen) doListen() {
 	defer listen.listener.Close()
+	listen.acceptLoop(listen.dispatch, listen.startConnection)
+}
 
-	for {
-		conn, err := listen.listener.Accept()
-		if err != nil {
-			log.Print(err)
-		}
+func (listen *tcpListen) dispatch(conn net.Conn) {
+	if listen.opts.ProxyProtocol {
+		// Reading the header can block, so we do it in the
+		// background.
+		go listen.acceptProxy(conn)
+		return
+	}
+
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		// Handshake in the background so a slow client
+		// can't hold up other connections.
+		go listen.handshake(tlsConn)
+		return
+	}
+
+	listen.startConnection(conn)
+}
+
+func (listen *tcpListen) connectionReady(conn net.Conn) {
+	// Called by the handshake goroutines to hand a connection back
+	// to doListen, which may have stopped in the meantime.
+	select {
+	case listen.ready <- conn:
+	case <-listen.done:
+		conn.Close()
+	}
+}
+
+func newTcpConn(id string, conn net.Conn) tcpConn {
+	c := tcpConn{}
+	c.conn = conn
+	c.id = id
+	c.writeTimedOut = make(chan struct{})
+	c.inputDone = make(chan struct{})
+	c.fromConn = make(chan message)
+	c.toConn = make(chan message)
+	c.attributes = newConnAttributes()
+	c.recordAttributes()
 
-		c := tcpConn{}
-		c.conn = conn
-		c.id = listen.id + "-" + conn.RemoteAddr().String()
-		c.fromConn = make(chan message)
-		c.toConn = make(chan message)
+	return c
+}
 
-		msg := NewConnectionMessage{}
-		msg.Conn = c
-		listen.notify <- msg
+func (tcp tcpConn) recordAttributes() {
+	// What the TLS handshake, PROXY header or Unix socket told us
+	// about the far end, for filters and apps that only see a
+	// Connection
+	subject, ok := tcp.PeerSubject()
+	if ok {
+		tcp.attributes.set(AttrPeerSubject, subject.String())
+	}
 
-		go c.connectionInputHandler()
-		go c.connectionOutputHandler()
+	cred, err := tcp.PeerCred()
+	if err == nil {
+		tcp.attributes.set(AttrPeerPid, strconv.Itoa(cred.Pid))
+		tcp.attributes.set(AttrPeerUid, strconv.Itoa(cred.Uid))
+		tcp.attributes.set(AttrPeerGid, strconv.Itoa(cred.Gid))
+	}
+
+	values := make(map[string][]string)
+	for _, tlv := range tcp.ProxyTLVs() {
+		attr := AttrProxyTlv + strconv.Itoa(int(tlv.Type))
+		values[attr] = append(values[attr], hex.EncodeToString(tlv.Value))
+	}
+	for attr, value := range values {
+		tcp.attributes.set(attr, strings.Join(value, ","))
 	}
 }
 
+func (listen *tcpListen) connectionId(conn net.Conn) string {
+	if _, ok := conn.(*net.UnixConn); ok {
+		// Unix socket clients almost never have an address, so
+		// we number them instead.
+		return listen.id + "-" + nextUnixPeer()
+	}
+
+	return listen.id + "-" + conn.RemoteAddr().String()
+}
+
+func (listen *tcpListen) startConnection(conn net.Conn) {
+	if listen.overLimit(conn) {
+		return
+	}
+
+	c := newTcpConn(listen.connectionId(conn), conn)
+	c.tracker = listen.tracker
+	c.tracker.add(conn)
+	c.timeouts = listen.opts.Timeouts
+	c.halfClose = listen.opts.HalfClose
+	c.setKeepAlive()
+
+	msg := NewConnectionMessage{}
+	msg.Conn = c
+	listen.notify <- msg
+
+	go c.connectionInputHandler()
+	go c.connectionOutputHandler()
+}
+
 func (c *tcpConn) connectionOutputHandler() {
 	defer close(c.fromConn)
 
 	b := make([]byte, 65535) // Largest possible TCP payload
-	n, err := io.ReadAtLeast(c.conn, b, 1)
+	n, err := c.read(b)
 	for err == nil && n > 0 {
 		newSlice := make([]byte, n)
 		copy(newSlice, b[:n])
 		c.fromConn <- DataMessage{Data: newSlice}
-		n, err = io.ReadAtLeast(c.conn, b, 1)
+		n, err = c.read(b)
 	}
 	if err != nil {
-		if err == io.EOF {
-			c.fromConn <- DisconnectMessage{}
-		} else {
-			c.fromConn <- ErrorMessage{Err: err}
+		if err == io.EOF && c.halfClose {
+			// The far end may still be listening, so our user
+			// gets to finish talking before we're done.
+			c.fromConn <- InputEndedMessage{}
+			<-c.inputDone
+			return
+		}
+		c.fromConn <- c.closingMessage(err)
+	}
+}
+
+func (c *tcpConn) read(b []byte) (int, error) {
+	if c.timeouts.ReadIdle > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.timeouts.ReadIdle))
+	}
+	return io.ReadAtLeast(c.conn, b, 1)
+}
+
+func (c *tcpConn) closingMessage(err error) message {
+	// Works out what to tell our user about why we stopped reading.
+	select {
+	case <-c.writeTimedOut:
+		return ErrorMessage{Err: errors.New("write timed out"), Reason: DisconnectReasonWriteTimeout}
+	default:
+	}
+
+	if err == io.EOF {
+		return DisconnectMessage{}
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		// Hang up on them, so the input handler notices too
+		c.conn.Close()
+		return DisconnectMessage{Reason: DisconnectReasonReadIdle}
+	}
+	if errors.Is(err, syscall.ETIMEDOUT) {
+		return ErrorMessage{Err: err, Reason: DisconnectReasonKeepAlive}
+	}
+	return ErrorMessage{Err: err}
+}
+
+func (c *tcpConn) setKeepAlive() {
+	// Linux waits for nine unanswered probes, so a dead peer is
+	// noticed after about ten times the interval.
+	if c.timeouts.KeepAlive == 0 {
+		return
+	}
+
+	tcp := tcpSocket(c.conn)
+	if tcp == nil {
+		return
+	}
+	if c.timeouts.KeepAlive < 0 {
+		tcp.SetKeepAlive(false)
+		return
+	}
+	tcp.SetKeepAlive(true)
+	tcp.SetKeepAlivePeriod(c.timeouts.KeepAlive)
+	err := setKeepAliveInterval(tcp, c.timeouts.KeepAlive)
+	if err != nil {
+		log.Print("Could not set keepalive interval: " + err.Error())
+	}
+}
+
+func closeWrite(conn net.Conn) error {
+	for {
+		switch c := conn.(type) {
+		case interface{ CloseWrite() error }:
+			return c.CloseWrite()
+		case *proxyConn:
+			conn = c.Conn
+		case *bufferedConn:
+			conn = c.Conn
+		case *trackedConn:
+			conn = c.Conn
+		default:
+			return errors.New("connection can't be half closed")
+		}
+	}
+}
+
+func tcpSocket(conn net.Conn) *net.TCPConn {
+	// Finds the TCP socket underneath any wrappers.
+	for {
+		switch c := conn.(type) {
+		case *net.TCPConn:
+			return c
+		case *tls.Conn:
+			conn = c.NetConn()
+		case *proxyConn:
+			conn = c.Conn
+		case *bufferedConn:
+			conn = c.Conn
+		case *trackedConn:
+			conn = c.Conn
+		default:
+			return nil
 		}
 	}
 }
 
 func (c *tcpConn) connectionInputHandler() {
+	// If writing fails our user finds out from the output handler,
+	// and we don't want them stuck sending to us until then.
+	failed := false
+	defer func() {
+		if failed {
+			drainMessages(c.toConn)
+		}
+	}()
+	defer close(c.inputDone)
 	defer c.conn.Close()
+	if c.tracker != nil {
+		defer c.tracker.remove(c.conn)
+	}
 	for {
 		m, ok := <-c.toConn
 		if !ok {
@@ -104,11 +333,30 @@ func (c *tcpConn) connectionInputHandler() {
 		case DataMessage:
 			dataMsg := m.(DataMessage)
 			b := dataMsg.Data
+			if c.timeouts.WriteTimeout > 0 {
+				c.conn.SetWriteDeadline(time.Now().Add(c.timeouts.WriteTimeout))
+			}
 			n, err := c.conn.Write(b)
 			if err != nil || n != len(b) {
-				log.Print("Could not write full message out of socket")
+				if errors.Is(err, os.ErrDeadlineExceeded) {
+					close(c.writeTimedOut)
+					log.Print("Write timed out, dropping " + c.id)
+				} else {
+					log.Print("Could not write full message out of socket")
+				}
+				failed = true
 				return
 			}
+		case UrgentDataMessage:
+			err := sendUrgent(c.conn, m.(UrgentDataMessage).Data)
+			if err != nil {
+				log.Print("Could not send urgent data: " + err.Error())
+			}
+		case InputEndedMessage:
+			err := closeWrite(c.conn)
+			if err != nil {
+				log.Print("Could not half close: " + err.Error())
+			}
 		case DisconnectMessage:
 			return
 		default:
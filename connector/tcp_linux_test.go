@@ -0,0 +1,44 @@
+package connector
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func tcpTestSockopt(t *testing.T, conn net.Conn, level int, opt int) int {
+	raw, err := tcpSocket(conn).SyscallConn()
+	assert.Equal(t, nil, err, "Raw socket found")
+
+	var value int
+	var optErr error
+	err = raw.Control(func(fd uintptr) {
+		value, optErr = unix.GetsockoptInt(int(fd), level, opt)
+	})
+	assert.Equal(t, nil, err, "Raw socket usable")
+	assert.Equal(t, nil, optErr, "Socket option read")
+	return value
+}
+
+func TestTcpKeepAlive(t *testing.T) {
+	t.Parallel()
+
+	conn, outbound := tcpTestTimeoutConnection(t, TcpTimeouts{KeepAlive: 3 * time.Second})
+	defer outbound.Close()
+
+	c := conn.(tcpConn)
+	assert.Equal(t, 1, tcpTestSockopt(t, c.conn, unix.SOL_SOCKET, unix.SO_KEEPALIVE), "Keepalive on")
+	assert.Equal(t, 3, tcpTestSockopt(t, c.conn, unix.IPPROTO_TCP, unix.TCP_KEEPINTVL), "Keepalive interval set")
+	assert.Equal(t, 3, tcpTestSockopt(t, c.conn, unix.IPPROTO_TCP, unix.TCP_KEEPIDLE), "Keepalive idle time set")
+	close(conn.ToConn())
+
+	conn, outbound = tcpTestTimeoutConnection(t, TcpTimeouts{KeepAlive: -1})
+	defer outbound.Close()
+
+	c = conn.(tcpConn)
+	assert.Equal(t, 0, tcpTestSockopt(t, c.conn, unix.SOL_SOCKET, unix.SO_KEEPALIVE), "Keepalive off")
+	close(conn.ToConn())
+}
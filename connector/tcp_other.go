@@ -0,0 +1,12 @@
+//go:build !unix
+
+package connector
+
+import (
+	"errors"
+	"net"
+)
+
+func sendUrgent(conn net.Conn, b []byte) error {
+	return errors.New("urgent data is not supported on this platform")
+}
@@ -1,10 +1,14 @@
 package connector
 
 import (
+	"errors"
+	"io"
 	"net"
 	"regexp"
 	"strconv"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -60,3 +64,121 @@ func TestTcpListen(t *testing.T) {
 	_, ok = <-connectionMsg.Conn.FromConn()
 	assert.False(t, ok, "Channel closed")
 }
+
+func tcpTestTimeoutConnection(t *testing.T, timeouts TcpTimeouts) (Connection, net.Conn) {
+	listen, err := NewTcpListenWithOptions("0", "127.0.0.1:0", TcpListenOptions{Timeouts: timeouts})
+	assert.Equal(t, nil, err, "Listener does not return error")
+
+	outbound, err := net.Dial("tcp", listen.Addr.String())
+	assert.Equal(t, nil, err, "Error from net.Dial()")
+
+	m := <-listen.Notify()
+	return m.(NewConnectionMessage).Conn, outbound
+}
+
+func TestTcpReadIdle(t *testing.T) {
+	t.Parallel()
+
+	conn, outbound := tcpTestTimeoutConnection(t, TcpTimeouts{ReadIdle: 100 * time.Millisecond})
+	defer outbound.Close()
+
+	// Talking keeps us alive
+	for i := 0; i < 3; i++ {
+		time.Sleep(50 * time.Millisecond)
+		outbound.Write([]byte("Hello"))
+		m := <-conn.FromConn()
+		assert.Equal(t, "Hello", m.(DataMessage).String(), "Data received")
+	}
+
+	m := <-conn.FromConn()
+	assert.Equal(t, DisconnectMessage{Reason: DisconnectReasonReadIdle}, m, "Read idle disconnect")
+	_, ok := <-conn.FromConn()
+	assert.False(t, ok, "Channel closed")
+
+	b := make([]byte, 1)
+	_, err := outbound.Read(b)
+	assert.Equal(t, io.EOF, err, "Outbound connection hung up")
+	close(conn.ToConn())
+}
+
+func TestTcpWriteTimeout(t *testing.T) {
+	t.Parallel()
+
+	conn, outbound := tcpTestTimeoutConnection(t, TcpTimeouts{WriteTimeout: 100 * time.Millisecond})
+	defer outbound.Close()
+	outbound.(*net.TCPConn).SetReadBuffer(4096)
+
+	// We never read, so eventually a write will block
+	big := NewDataMessage(make([]byte, 1024*1024))
+	var m message
+	for m == nil {
+		select {
+		case conn.ToConn() <- big:
+		case m = <-conn.FromConn():
+		}
+	}
+	assert.IsType(t, ErrorMessage{}, m, "Write timeout error")
+	assert.Equal(t, DisconnectReasonWriteTimeout, m.(ErrorMessage).Reason, "Write timeout reason")
+
+	// Our sends don't block even though nobody is writing them
+	conn.ToConn() <- big
+	_, ok := <-conn.FromConn()
+	assert.False(t, ok, "Channel closed")
+	close(conn.ToConn())
+}
+
+func TestTcpKeepAliveFailure(t *testing.T) {
+	t.Parallel()
+
+	conn, outbound := tcpTestTimeoutConnection(t, TcpTimeouts{KeepAlive: time.Second})
+	defer outbound.Close()
+
+	c := conn.(tcpConn)
+	assert.NotNil(t, tcpSocket(c.conn), "TCP socket found")
+	assert.NotNil(t, tcpSocket(&bufferedConn{Conn: c.conn}), "TCP socket found under wrapper")
+
+	err := &net.OpError{Op: "read", Err: syscall.ETIMEDOUT}
+	m := c.closingMessage(err)
+	assert.Equal(t, DisconnectReasonKeepAlive, m.(ErrorMessage).Reason, "Keepalive failure reason")
+	assert.True(t, errors.Is(m.(ErrorMessage).Err, syscall.ETIMEDOUT), "Keepalive failure error")
+
+	close(conn.ToConn())
+}
+
+func TestTcpHalfClose(t *testing.T) {
+	t.Parallel()
+
+	listen, err := NewTcpListenWithOptions("0", "127.0.0.1:0", TcpListenOptions{HalfClose: true})
+	assert.Equal(t, nil, err, "Listener does not return error")
+
+	outbound, err := net.Dial("tcp", listen.Addr.String())
+	assert.Equal(t, nil, err, "Error from net.Dial()")
+	defer outbound.Close()
+	m := <-listen.Notify()
+	conn := m.(NewConnectionMessage).Conn
+
+	// Like nc -N sending a command
+	outbound.Write([]byte("Hello"))
+	outbound.(*net.TCPConn).CloseWrite()
+
+	m = <-conn.FromConn()
+	assert.Equal(t, "Hello", m.(DataMessage).String(), "Data received")
+	m = <-conn.FromConn()
+	assert.Equal(t, InputEndedMessage{}, m, "Input ended")
+
+	conn.ToConn() <- NewDataMessageFromString("Foo")
+	conn.ToConn() <- InputEndedMessage{}
+	b, err := io.ReadAll(outbound)
+	assert.Equal(t, nil, err, "Outbound read has no error")
+	assert.Equal(t, "Foo", string(b), "Output sent after input ended")
+
+	select {
+	case m = <-conn.FromConn():
+		t.Errorf("Message before we are done: %s", m.TypeString())
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(conn.ToConn())
+	_, ok := <-conn.FromConn()
+	assert.False(t, ok, "Channel closed")
+}
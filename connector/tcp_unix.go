@@ -0,0 +1,32 @@
+//go:build unix
+
+package connector
+
+import (
+	"errors"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+func sendUrgent(conn net.Conn, b []byte) error {
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok {
+		return errors.New("urgent data needs a TCP socket")
+	}
+
+	raw, err := tcp.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var sendErr error
+	err = raw.Write(func(fd uintptr) bool {
+		sendErr = unix.Sendto(int(fd), b, unix.MSG_OOB, nil)
+		return sendErr != unix.EAGAIN
+	})
+	if err != nil {
+		return err
+	}
+	return sendErr
+}
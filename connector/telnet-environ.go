@@ -0,0 +1,130 @@
+package connector
+
+import (
+	"log"
+)
+
+const (
+	telnetEnvironIs   byte = 0
+	telnetEnvironSend byte = 1
+	telnetEnvironInfo byte = 2
+
+	telnetEnvironVar     byte = 0
+	telnetEnvironValue   byte = 1
+	telnetEnvironEsc     byte = 2
+	telnetEnvironUserVar byte = 3
+)
+
+// Connection attributes set from NEW-ENVIRON, followed by the
+// variable name (such as "env:USER")
+const (
+	AttrEnvironVar     = "env:"
+	AttrEnvironUserVar = "uservar:"
+)
+
+// One variable from an IS or INFO
+type telnetEnvironEntry struct {
+	userVar bool
+	name    []byte
+	value   []byte
+	defined bool // False if the client sent no VALUE
+}
+
+func (telnet *telnetFilter) requestEnviron() {
+	// We always want USER, plus whatever we were configured with
+	telnet.environRequested = true
+
+	data := []byte{telnetEnvironSend, telnetEnvironVar}
+	data = append(data, telnetEnvironEscape("USER")...)
+	for _, name := range telnet.opts.EnvironVars {
+		data = append(data, telnetEnvironVar)
+		data = append(data, telnetEnvironEscape(name)...)
+	}
+	for _, name := range telnet.opts.EnvironUserVars {
+		data = append(data, telnetEnvironUserVar)
+		data = append(data, telnetEnvironEscape(name)...)
+	}
+
+	telnet.sendSubnegotiation(telnetOptNewEnviron, data)
+}
+
+func (telnet *telnetFilter) handleEnviron(data []byte) {
+	// Clients send INFO whenever they like, not just after we ask,
+	// so we take either at any time.
+	if len(data) == 0 {
+		return
+	}
+	if data[0] != telnetEnvironIs && data[0] != telnetEnvironInfo {
+		log.Printf("Ignoring NEW-ENVIRON command (%d)", data[0])
+		return
+	}
+
+	msg := EnvironmentMessage{}
+	msg.Vars = make(map[string]string)
+	msg.UserVars = make(map[string]string)
+	msg.Info = data[0] == telnetEnvironInfo
+
+	for _, entry := range parseEnviron(data[1:]) {
+		name := string(entry.name)
+		vars := msg.Vars
+		attr := AttrEnvironVar + name
+		if entry.userVar {
+			vars = msg.UserVars
+			attr = AttrEnvironUserVar + name
+		}
+
+		if entry.defined {
+			vars[name] = string(entry.value)
+			telnet.attributes.set(attr, string(entry.value))
+		} else {
+			telnet.attributes.unset(attr)
+		}
+	}
+
+	telnet.fromClient <- msg
+}
+
+func parseEnviron(data []byte) []telnetEnvironEntry {
+	// Splits the body of an IS or INFO into variables.  Anything
+	// before the first VAR or USERVAR is junk.
+	entries := make([]telnetEnvironEntry, 0)
+	var field *[]byte
+
+	for i := 0; i < len(data); i++ {
+		b := data[i]
+		if b == telnetEnvironEsc {
+			i++
+			if i == len(data) {
+				break
+			}
+			b = data[i]
+		} else if b == telnetEnvironVar || b == telnetEnvironUserVar {
+			entries = append(entries, telnetEnvironEntry{userVar: b == telnetEnvironUserVar})
+			field = &entries[len(entries)-1].name
+			continue
+		} else if b == telnetEnvironValue {
+			if len(entries) > 0 {
+				entries[len(entries)-1].defined = true
+				field = &entries[len(entries)-1].value
+			}
+			continue
+		}
+
+		if field != nil {
+			*field = append(*field, b)
+		}
+	}
+
+	return entries
+}
+
+func telnetEnvironEscape(name string) []byte {
+	escaped := make([]byte, 0, len(name))
+	for _, b := range []byte(name) {
+		if b <= telnetEnvironUserVar {
+			escaped = append(escaped, telnetEnvironEsc)
+		}
+		escaped = append(escaped, b)
+	}
+	return escaped
+}
@@ -0,0 +1,88 @@
+package connector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTelnetEnviron(t *testing.T) {
+	t.Parallel()
+
+	dummy, err := NewDummyConnection("0")
+	assert.Equal(t, nil, err, "No dummy connection error")
+
+	opts := TelnetOptions{EnvironVars: []string{"LANG"}, EnvironUserVars: []string{"ROUTE"}}
+	telnet, err := NewTelnetFilterWithOptions(dummy, opts)
+	assert.Equal(t, nil, err, "No telnet filter error")
+	telnetTestSkipNegotiation(t, dummy, 9)
+
+	dummy.Send(NewDataMessage([]byte{255, 251, 39})) // WILL NEW-ENVIRON
+	o, ok := dummy.Recv()
+	assert.True(t, ok, "No dummy receive error")
+	send := []byte{255, 250, 39, 1, 0, 'U', 'S', 'E', 'R', 0, 'L', 'A', 'N', 'G', 3, 'R', 'O', 'U', 'T', 'E', 255, 240}
+	assert.Equal(t, send, o.(DataMessage).Data, "Sent SB NEW-ENVIRON SEND")
+
+	// LANG is undefined, and ROUTE has an escaped VALUE in it
+	is := []byte{255, 250, 39, 0, 0, 'U', 'S', 'E', 'R', 1, 'j', 'o', 'e', 'l', 0, 'L', 'A', 'N', 'G'}
+	is = append(is, 3, 'R', 'O', 'U', 'T', 'E', 1, 'a', 2, 1, 'b', 255, 240)
+	dummy.Send(NewDataMessage(is))
+
+	m := <-telnet.FromConn()
+	expected := EnvironmentMessage{
+		Vars:     map[string]string{"USER": "joel"},
+		UserVars: map[string]string{"ROUTE": "a\x01b"},
+	}
+	assert.Equal(t, expected, m, "Environment published")
+
+	attributes := telnet.Attributes().All()
+	assert.Equal(t, map[string]string{"env:USER": "joel", "uservar:ROUTE": "a\x01b"}, attributes, "Environment recorded")
+
+	close(telnet.ToConn())
+}
+
+func TestTelnetEnvironInfo(t *testing.T) {
+	t.Parallel()
+
+	dummy, err := NewDummyConnection("0")
+	assert.Equal(t, nil, err, "No dummy connection error")
+
+	telnet, err := NewTelnetFilter(dummy)
+	assert.Equal(t, nil, err, "No telnet filter error")
+	telnetTestSkipNegotiation(t, dummy, 9)
+
+	// INFO without being asked, or even agreeing to the option
+	dummy.Send(NewDataMessage([]byte{255, 250, 39, 2, 0, 'U', 'S', 'E', 'R', 1, 'a', 'n', 'n', 255, 240}))
+	m := <-telnet.FromConn()
+	expected := EnvironmentMessage{Vars: map[string]string{"USER": "ann"}, UserVars: map[string]string{}, Info: true}
+	assert.Equal(t, expected, m, "Unsolicited INFO published")
+	value, ok := telnet.Attributes().Get(AttrEnvironVar + "USER")
+	assert.True(t, ok, "USER recorded")
+	assert.Equal(t, "ann", value, "USER recorded")
+
+	// Now it's gone
+	dummy.Send(NewDataMessage([]byte{255, 250, 39, 2, 0, 'U', 'S', 'E', 'R', 255, 240}))
+	m = <-telnet.FromConn()
+	expected = EnvironmentMessage{Vars: map[string]string{}, UserVars: map[string]string{}, Info: true}
+	assert.Equal(t, expected, m, "Undefined variable left out")
+	_, ok = telnet.Attributes().Get(AttrEnvironVar + "USER")
+	assert.False(t, ok, "USER removed")
+
+	close(telnet.ToConn())
+}
+
+func TestTelnetEnvironParse(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, []byte{'A', 2, 0, 2, 2, 'B'}, telnetEnvironEscape("A\x00\x02B"), "Escaped name")
+
+	// Junk before the first VAR, and a trailing ESC
+	entries := parseEnviron([]byte{'x', 2, 0, 0, 'A', 1, 'b', 3, 'C', 2})
+	assert.Equal(t, 2, len(entries), "Two variables")
+	assert.Equal(t, "A", string(entries[0].name), "First name")
+	assert.Equal(t, "b", string(entries[0].value), "First value")
+	assert.True(t, entries[0].defined, "First is defined")
+	assert.True(t, entries[1].userVar, "Second is a USERVAR")
+	assert.Equal(t, "C", string(entries[1].name), "Second name")
+	assert.False(t, entries[1].defined, "Second is undefined")
+}
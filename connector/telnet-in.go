@@ -1,27 +1,55 @@
 package connector
 
 import (
+	"encoding/binary"
 	"log"
 	"reflect"
 	"regexp"
 )
 
+type TelnetOptions struct {
+	EnvironVars     []string // NEW-ENVIRON VARs to ask the client for, as well as USER
+	EnvironUserVars []string // NEW-ENVIRON USERVARs to ask the client for
+}
+
 type telnetFilter struct {
 	id                string
+	opts              TelnetOptions
 	inboundConnection Connection
 	fromClient        chan message
 	toClient          chan message
 	readBuffer        []byte // Store partial reads, such as data terminating in an IAC character
 	writeBuffer       []byte // Used when we are still negotiating with client before sending
 	charInterrupt     byte
-	pendingDo         map[telnetOption]bool // Pending DO commands
-	pendingWill       map[telnetOption]bool // Pending WILL commands
+	options           map[telnetOption]*telnetQOption
 	optReceiveBinary  bool
 	optSendBinary     bool
 	regexpNewline     regexp.Regexp
+	inSubnegotiation  bool   // Between IAC SB and IAC SE
+	subnegotiation    []byte // Subnegotiation received so far
+	sbHandlers        map[telnetOption]telnetSubnegotiationHandler
+	attributes        *ConnAttributes
+
+	// Terminal types the client has told us about so far
+	terminalTypes     []string
+	terminalTypesDone bool
+
+	environRequested bool // Sent NEW-ENVIRON SEND
+
+	lineMode       LineModeMessage // The mode we want, or the client agreed to
+	lineModeReport bool            // An app is waiting to hear the client agree
+	forwardMask    bool            // The client agreed to our FORWARDMASK
+	slc            map[byte]telnetSlc
+
+	// Used when we're the client side of the connection
+	client       bool
+	terminalType string
+	windowSize   *WindowSizeMessage
 }
 
 const (
+	telnetSE      byte = 240
+	telnetSB      byte = 250
 	telnetGoAhead byte = 249
 	telnetWill    byte = 251
 	telnetWont    byte = 252
@@ -40,20 +68,44 @@ const (
 	telnetOptTimingMark
 )
 
+const (
+	telnetOptTerminalType telnetOption = 24
+	telnetOptNaws         telnetOption = 31
+	telnetOptLineMode     telnetOption = 34
+	telnetOptNewEnviron   telnetOption = 39
+)
+
+// Called with the bytes between IAC SB <option> and IAC SE, with any
+// escaping already undone.
+type telnetSubnegotiationHandler func(telnet *telnetFilter, data []byte)
+
+// Longest subnegotiation we'll hold on to
+const telnetMaxSubnegotiation = 4096
+
 func (opt telnetOption) Byte() byte {
 	return byte(reflect.ValueOf(opt).Uint())
 }
 
-func (telnet telnetFilter) Id() string             { return telnet.id }
-func (telnet telnetFilter) FromConn() chan message { return telnet.fromClient }
-func (telnet telnetFilter) ToConn() chan message   { return telnet.toClient }
+func (telnet telnetFilter) Id() string                  { return telnet.id }
+func (telnet telnetFilter) FromConn() chan message      { return telnet.fromClient }
+func (telnet telnetFilter) ToConn() chan message        { return telnet.toClient }
+func (telnet telnetFilter) Attributes() *ConnAttributes { return telnet.attributes }
 
 func NewTelnetFilter(conn Connection) (telnetFilter, error) {
+	return NewTelnetFilterWithOptions(conn, TelnetOptions{})
+}
+
+func NewTelnetFilterWithOptions(conn Connection, opts TelnetOptions) (telnetFilter, error) {
 	telnet := telnetFilter{}
 
 	telnet.inboundConnection = conn
+	telnet.opts = opts
 	telnet.id = conn.Id() + "-(telnet)"
 	telnet.fillDefaults()
+	telnet.onSubnegotiation(telnetOptNaws, (*telnetFilter).handleNaws)
+	telnet.onSubnegotiation(telnetOptTerminalType, (*telnetFilter).handleTerminalType)
+	telnet.onSubnegotiation(telnetOptNewEnviron, (*telnetFilter).handleEnviron)
+	telnet.onSubnegotiation(telnetOptLineMode, (*telnetFilter).handleLineMode)
 
 	go telnet.doFilter()
 
@@ -63,13 +115,26 @@ func NewTelnetFilter(conn Connection) (telnetFilter, error) {
 func (telnet *telnetFilter) fillDefaults() {
 	telnet.fromClient = make(chan message)
 	telnet.toClient = make(chan message)
-	telnet.pendingDo = make(map[telnetOption]bool)
-	telnet.pendingWill = make(map[telnetOption]bool)
+	telnet.options = make(map[telnetOption]*telnetQOption)
 	telnet.charInterrupt = 3
 	telnet.optReceiveBinary = false
 	telnet.optSendBinary = false
 	telnet.readBuffer = make([]byte, 0)
 	telnet.writeBuffer = make([]byte, 0)
+	telnet.subnegotiation = make([]byte, 0)
+	telnet.sbHandlers = make(map[telnetOption]telnetSubnegotiationHandler)
+	attributes, ok := ConnectionAttributes(telnet.inboundConnection)
+	if !ok {
+		attributes = newConnAttributes()
+	}
+	telnet.attributes = attributes
+	telnet.terminalTypes = make([]string, 0)
+	telnet.slc = make(map[byte]telnetSlc)
+}
+
+func (telnet *telnetFilter) onSubnegotiation(opt telnetOption, handler telnetSubnegotiationHandler) {
+	// Handlers are registered before the filter starts running.
+	telnet.sbHandlers[opt] = handler
 }
 
 func (telnet *telnetFilter) doFilter() {
@@ -117,12 +182,29 @@ func (telnet *telnetFilter) processInboundData(b []byte) {
 		return
 	}
 
+	// Data before a command goes out before anything the command
+	// makes us send.
 	out := make([]byte, 0)
+	flush := func() {
+		if len(out) > 0 {
+			telnet.fromClient <- NewDataMessage(out)
+			out = make([]byte, 0)
+		}
+	}
+
 	skipNext := 0
 	for i := range b {
 		if skipNext > 0 {
 			skipNext--
 			continue
+		} else if telnet.inSubnegotiation {
+			var ended bool
+			skipNext, ended = telnet.processSubnegotiationByte(b, i)
+			if ended {
+				flush()
+				telnet.endSubnegotiation()
+			}
+			continue
 		} else if b[i] == 255 {
 			if (l - 1) == i {
 				// No character following!
@@ -141,10 +223,21 @@ func (telnet *telnetFilter) processInboundData(b []byte) {
 				skipNext = 1
 				out = append(out, telnet.charInterrupt)
 				continue
+			} else if function, ok := telnetSlcCommands[b[i+1]]; ok {
+				// Sent in place of a special character,
+				// such as by clients in line mode
+				skipNext = 1
+				out = append(out, telnet.slcChar(function))
+				continue
 			} else if b[i+1] == 241 {
 				// NOOP, so we do nothing
 				skipNext = 1
 				continue
+			} else if b[i+1] == telnetSB {
+				skipNext = 1
+				telnet.inSubnegotiation = true
+				telnet.subnegotiation = make([]byte, 0)
+				continue
 			} else if b[i+1] < 251 {
 				// We don't know what to do with it. So
 				// just will eat it and puke anything
@@ -166,16 +259,17 @@ func (telnet *telnetFilter) processInboundData(b []byte) {
 			// We know we have enough data to process the
 			// command
 			skipNext = 2
+			flush()
 
 			switch b[i+1] {
-			case 251:
-				telnet.handleWill(telnetOption(b[i+2]))
-			case 252:
-				telnet.handleWont(telnetOption(b[i+2]))
-			case 253:
-				telnet.handleDo(telnetOption(b[i+2]))
-			case 254:
-				telnet.handleDont(telnetOption(b[i+2]))
+			case telnetWill:
+				telnet.receiveEnable(telnetOption(b[i+2]), true)
+			case telnetWont:
+				telnet.receiveDisable(telnetOption(b[i+2]), true)
+			case telnetDo:
+				telnet.receiveEnable(telnetOption(b[i+2]), false)
+			case telnetDont:
+				telnet.receiveDisable(telnetOption(b[i+2]), false)
 			}
 			continue
 		} else if b[i] == 10 && !telnet.optReceiveBinary {
@@ -191,18 +285,43 @@ func (telnet *telnetFilter) processInboundData(b []byte) {
 		}
 	}
 
-	if len(out) > 0 {
-		msg := NewDataMessage(out)
-		telnet.fromClient <- msg
-	}
+	flush()
 }
 
 func (telnet *telnetFilter) processToClient(m message) {
 	// Process traffic needing to go out to the inboundConnection
 	// (potentially).
 
+	if m.Type() == MTInputEndedMessage {
+		// Nothing more can go out after this, so anything held back
+		// while negotiating has to go first.
+		telnet.flushWriteBuffer()
+		telnet.inboundConnection.ToConn() <- m
+		return
+	}
+
+	if m.Type() == MTWindowSizeMessage && telnet.client {
+		size := m.(WindowSizeMessage)
+		telnet.windowSize = &size
+		telnet.sendWindowSize()
+		return
+	}
+
+	if m.Type() == MTTelnetOptionRequestMessage {
+		request := m.(TelnetOptionRequestMessage)
+		opt := telnetOption(request.Option)
+		telnet.qSide(opt, request.Remote).requested = true
+		telnet.requestOption(opt, request.Remote, request.Enable)
+		return
+	}
+
+	if m.Type() == MTLineModeMessage && !telnet.client {
+		telnet.setLineMode(m.(LineModeMessage))
+		return
+	}
+
 	if m.Type() == MTDataMessage {
-		if len(telnet.pendingWill) > 0 {
+		if telnet.negotiating() {
 			telnet.writeBuffer = append(telnet.writeBuffer, m.(DataMessage).Data...)
 			return
 		}
@@ -212,6 +331,14 @@ func (telnet *telnetFilter) processToClient(m message) {
 
 }
 
+func (telnet *telnetFilter) flushWriteBuffer() {
+	if len(telnet.writeBuffer) > 0 {
+		data := telnet.writeBuffer
+		telnet.writeBuffer = make([]byte, 0)
+		telnet.sendBytes(data)
+	}
+}
+
 func (telnet *telnetFilter) sendBytes(b []byte) {
 	var replaced []byte
 	if !telnet.optSendBinary {
@@ -225,24 +352,30 @@ func (telnet *telnetFilter) sendBytes(b []byte) {
 }
 
 func (telnet *telnetFilter) initNegotiate() {
+	if telnet.client {
+		telnet.clientInitNegotiate()
+		return
+	}
+
 	// Send initial negotiation, currently negotiating bidirectional
 	// binary mode, no echo, and no go-ahead messages.
-	telnet.pendingWill[telnetOptBinary] = true
-	telnet.pendingWill[telnetOptEcho] = true
-	telnet.pendingWill[telnetOptSuppressGoAhead] = true
-
-	telnet.pendingDo[telnetOptBinary] = true
-	telnet.pendingDo[telnetOptEcho] = false
-	telnet.pendingDo[telnetOptSuppressGoAhead] = true
-
-	telnet.sendWill(telnetOptBinary)
-	telnet.sendWill(telnetOptEcho)
-	telnet.sendWill(telnetOptSuppressGoAhead)
-
-	telnet.sendDo(telnetOptBinary)
-	// We don't send a don't echo because that's the default mode,
-	// and default mode options don't warrant an acknowledgement
-	telnet.sendDo(telnetOptSuppressGoAhead)
+	telnet.requestOption(telnetOptBinary, false, true)
+	telnet.requestOption(telnetOptEcho, false, true)
+	telnet.requestOption(telnetOptSuppressGoAhead, false, true)
+
+	telnet.requestOption(telnetOptBinary, true, true)
+	// Some clients start with local echo enabled without saying so,
+	// so we tell them not to echo.  This isn't a request as far as
+	// the Q method goes, since a client that already wasn't echoing
+	// won't answer, and a later WILL ECHO is refused as usual.
+	telnet.sendDont(telnetOptEcho)
+	telnet.requestOption(telnetOptSuppressGoAhead, true, true)
+
+	// We'd like to know the client's window size (RFC 1073),
+	// terminal type (RFC 1091) and environment (RFC 1572)
+	telnet.requestOption(telnetOptNaws, true, true)
+	telnet.requestOption(telnetOptTerminalType, true, true)
+	telnet.requestOption(telnetOptNewEnviron, true, true)
 }
 
 func (telnet *telnetFilter) sendWill(opt telnetOption) {
@@ -269,6 +402,70 @@ func (telnet *telnetFilter) sendDont(opt telnetOption) {
 	telnet.inboundConnection.ToConn() <- msg
 }
 
+func (telnet *telnetFilter) sendSubnegotiation(opt telnetOption, data []byte) {
+	sb := []byte{telnetIAC, telnetSB, opt.Byte()}
+	sb = append(sb, telnetReplaceBytes(data, []byte{255}, [][]byte{{255, 255}})...)
+	sb = append(sb, telnetIAC, telnetSE)
+	msg := NewDataMessage(sb)
+	telnet.inboundConnection.ToConn() <- msg
+}
+
+func (telnet *telnetFilter) processSubnegotiationByte(b []byte, i int) (int, bool) {
+	// Collects the bytes between IAC SB and IAC SE, returning how
+	// many following bytes were also consumed, and whether we've
+	// reached the end.
+	if b[i] != 255 {
+		telnet.appendSubnegotiation(b[i])
+		return 0, false
+	}
+
+	if (len(b) - 1) == i {
+		// Need to see the next byte to know what this is
+		telnet.readBuffer = []byte{255}
+		return 0, false
+	} else if b[i+1] == 255 {
+		// Escaped 255 in the subnegotiation data
+		telnet.appendSubnegotiation(255)
+		return 1, false
+	} else if b[i+1] != telnetSE {
+		// Most likely a client that didn't escape a 255 in its
+		// data, so we take it as one and carry on to IAC SE.
+		log.Printf("Received invalid command (%d) in subnegotiation", b[i+1])
+		telnet.appendSubnegotiation(255)
+		return 0, false
+	}
+
+	return 1, true
+}
+
+func (telnet *telnetFilter) endSubnegotiation() {
+	telnet.inSubnegotiation = false
+	if len(telnet.subnegotiation) > telnetMaxSubnegotiation {
+		log.Printf("Dropped overlong subnegotiation for option (%d)", telnet.subnegotiation[0])
+	} else if len(telnet.subnegotiation) > 0 {
+		opt := telnetOption(telnet.subnegotiation[0])
+		telnet.handleSubnegotiation(opt, telnet.subnegotiation[1:])
+	}
+	telnet.subnegotiation = make([]byte, 0)
+}
+
+func (telnet *telnetFilter) appendSubnegotiation(b byte) {
+	// Past the limit we keep one extra byte, so we know to drop it
+	// at the end.
+	if len(telnet.subnegotiation) <= telnetMaxSubnegotiation {
+		telnet.subnegotiation = append(telnet.subnegotiation, b)
+	}
+}
+
+func (telnet *telnetFilter) handleSubnegotiation(opt telnetOption, data []byte) {
+	handler, ok := telnet.sbHandlers[opt]
+	if !ok {
+		log.Printf("Ignoring subnegotiation for unsupported option (%d)", opt)
+		return
+	}
+	handler(telnet, data)
+}
+
 func telnetReplaceBytes(src []byte, c []byte, replace [][]byte) []byte {
 	// Takes src, and anywhere one of the characters "c" occurs,
 	// replaces that with the string in the associated index in
@@ -291,104 +488,66 @@ func telnetReplaceBytes(src []byte, c []byte, replace [][]byte) []byte {
 	return b
 }
 
-func (telnet *telnetFilter) ackIfNeeded(opt telnetOption, response string) {
-	// This will send a response of type "response" if that would
-	// not be duplicating a previously sent response that wasn't
-	// acked/nacked by the other end.  It, as a side effect, removes
-	// the option from pendingDo or pendingWill response lists
-	// depending on if the response is a Do/Dont or Will/Wont, so
-	// that future packets of this type would get acked.
-
-	// Send do/don't
-	if response == "DO" {
-		_, ok := telnet.pendingDo[opt]
-		if ok {
-			delete(telnet.pendingDo, opt)
-		} else {
-			telnet.sendDo(opt)
-		}
-		return
-	} else if response == "DONT" {
-		_, ok := telnet.pendingDo[opt]
-		if ok {
-			delete(telnet.pendingDo, opt)
-		} else {
-			telnet.sendDont(opt)
-		}
-		return
-	}
-
-	if response != "WILL" && response != "WONT" {
-		log.Fatal("Unknown response type: " + response)
+func (telnet *telnetFilter) acceptOption(opt telnetOption, remote bool) bool {
+	// Whether we agree when the client asks to turn an option on,
+	// either at its end (remote) or ours.
+	if telnet.client {
+		return telnet.clientAcceptOption(opt, remote)
 	}
 
-	// So we should have a response to a will/won't, which might trigger us
-	// sending data.
-	_, ok := telnet.pendingWill[opt]
-	if ok {
-		delete(telnet.pendingWill, opt)
-		if len(telnet.pendingWill) == 0 {
-			if len(telnet.writeBuffer) > 0 {
-				data := telnet.writeBuffer
-				telnet.writeBuffer = make([]byte, 0)
-				telnet.sendBytes(data)
-			}
+	if remote {
+		// We never want to have the client do the echo!
+		switch opt {
+		case telnetOptBinary, telnetOptSuppressGoAhead, telnetOptNaws, telnetOptTerminalType, telnetOptNewEnviron, telnetOptLineMode:
+			return true
 		}
-		return
+		return false
 	}
 
-	// We have a will/won't, but no pending ack, so we need to ack.
-	if response == "WILL" {
-		telnet.sendWill(opt)
-	} else if response == "WONT" {
-		telnet.sendWont(opt)
+	// We don't actually send GoAheads anyhow.
+	switch opt {
+	case telnetOptBinary, telnetOptEcho, telnetOptSuppressGoAhead:
+		return true
 	}
+	return false
 }
 
-func (telnet *telnetFilter) handleWill(opt telnetOption) {
-	response := "DONT" // Default response
-	if opt == telnetOptBinary {
-		telnet.optReceiveBinary = true
-		response = "DO"
-	} else if opt == telnetOptEcho {
-		// We never want to have the client do the echo!
-		response = "DO"
-	} else if opt == telnetOptSuppressGoAhead {
-		response = "DO"
+func (telnet *telnetFilter) optionChanged(opt telnetOption, remote bool, enabled bool) {
+	if opt == telnetOptBinary && remote {
+		telnet.optReceiveBinary = enabled
+	} else if opt == telnetOptBinary {
+		telnet.optSendBinary = enabled
 	}
 
-	telnet.ackIfNeeded(opt, response)
-}
-
-func (telnet *telnetFilter) handleWont(opt telnetOption) {
-	response := "DONT" // Default response
-	if opt == telnetOptBinary {
-		telnet.optReceiveBinary = false
+	if telnet.client {
+		telnet.clientOptionChanged(opt, remote, enabled)
+		return
 	}
-
-	telnet.ackIfNeeded(opt, response)
-}
-
-func (telnet *telnetFilter) handleDo(opt telnetOption) {
-	response := "WONT" // Default response
-	if opt == telnetOptBinary {
-		telnet.optSendBinary = true
-		response = "WILL"
-	} else if opt == telnetOptEcho {
-		response = "WILL"
-	} else if opt == telnetOptSuppressGoAhead {
-		// We don't actually send GoAheads anyhoow.
-		response = "WILL"
+	if opt == telnetOptLineMode && remote {
+		telnet.lineModeChanged(enabled)
+	}
+	if !remote || !enabled {
+		return
 	}
 
-	telnet.ackIfNeeded(opt, response)
+	// Now the client has agreed, we can ask it about itself
+	if opt == telnetOptTerminalType && len(telnet.terminalTypes) == 0 && !telnet.terminalTypesDone {
+		telnet.requestTerminalType()
+	} else if opt == telnetOptNewEnviron && !telnet.environRequested {
+		telnet.requestEnviron()
+	}
 }
 
-func (telnet *telnetFilter) handleDont(opt telnetOption) {
-	response := "WONT" // Default response
-	if opt == telnetOptBinary {
-		telnet.optSendBinary = false
+func (telnet *telnetFilter) handleNaws(data []byte) {
+	// The client's window size, as 16 bit width and height.  Zero
+	// means the client doesn't know.
+	if len(data) != 4 {
+		log.Printf("Received invalid window size (%d bytes)", len(data))
+		return
 	}
 
-	telnet.ackIfNeeded(opt, response)
+	size := WindowSizeMessage{}
+	size.Width = int(binary.BigEndian.Uint16(data[0:2]))
+	size.Height = int(binary.BigEndian.Uint16(data[2:4]))
+	telnet.fromClient <- size
 }
@@ -48,6 +48,21 @@ func TestTelnet(t *testing.T) {
 	assert.IsType(t, DataMessage{}, o, "Data type is proper")
 	assert.Equal(t, []byte{255, 253, 3}, o.(DataMessage).Data, "Sent DO OPT Suppress Go Ahead")
 
+	o, ok = dummy.Recv()
+	assert.Equal(t, true, ok, "No dummy receive error")
+	assert.IsType(t, DataMessage{}, o, "Data type is proper")
+	assert.Equal(t, []byte{255, 253, 31}, o.(DataMessage).Data, "Sent DO OPT NAWS")
+
+	o, ok = dummy.Recv()
+	assert.Equal(t, true, ok, "No dummy receive error")
+	assert.IsType(t, DataMessage{}, o, "Data type is proper")
+	assert.Equal(t, []byte{255, 253, 24}, o.(DataMessage).Data, "Sent DO OPT Terminal Type")
+
+	o, ok = dummy.Recv()
+	assert.Equal(t, true, ok, "No dummy receive error")
+	assert.IsType(t, DataMessage{}, o, "Data type is proper")
+	assert.Equal(t, []byte{255, 253, 39}, o.(DataMessage).Data, "Sent DO OPT New Environ")
+
 	StartLoopApp(telnet)
 
 	dummy.Send(NewDataMessage([]byte{255, 253, 0, 255, 253, 1}))              // DO BINARY & ECHO
@@ -66,6 +81,30 @@ func TestTelnet(t *testing.T) {
 	dummy.Send(n)
 }
 
+func TestTelnetInputEnded(t *testing.T) {
+	t.Parallel()
+
+	dummy, err := NewDummyConnection("0")
+	assert.Equal(t, nil, err, "No dummy connection error")
+
+	telnet, err := NewTelnetFilter(dummy)
+	assert.Equal(t, nil, err, "No telnet filter error")
+	telnetTestSkipNegotiation(t, dummy, 9)
+
+	// The client hasn't answered yet, so this is held back
+	telnet.ToConn() <- NewDataMessageFromString("Bye")
+	telnet.ToConn() <- InputEndedMessage{}
+
+	o, ok := dummy.Recv()
+	assert.True(t, ok, "No dummy receive error")
+	assert.Equal(t, "Bye", o.(DataMessage).String(), "Held output sent first")
+	o, ok = dummy.Recv()
+	assert.True(t, ok, "No dummy receive error")
+	assert.Equal(t, InputEndedMessage{}, o, "Input ended after output")
+
+	close(telnet.ToConn())
+}
+
 func TestTelnetReplacement(t *testing.T) {
 	t.Parallel()
 
@@ -83,3 +122,96 @@ func TestTelnetReplacement(t *testing.T) {
 		assert.Equal(t, table[i][1], telnetReplaceBytes(table[i][0], chars, replace), "Replace successful")
 	}
 }
+
+func telnetTestSkipNegotiation(t *testing.T, dummy DummyConnection, count int) {
+	for i := 0; i < count; i++ {
+		_, ok := dummy.Recv()
+		assert.True(t, ok, "No dummy receive error")
+	}
+}
+
+func TestTelnetSubnegotiation(t *testing.T) {
+	t.Parallel()
+
+	dummy, err := NewDummyConnection("0")
+	assert.Equal(t, nil, err, "No dummy connection error")
+
+	received := make(chan []byte, 10)
+	telnet := telnetFilter{}
+	telnet.inboundConnection = dummy
+	telnet.id = dummy.Id() + "-(telnet)"
+	telnet.fillDefaults()
+	telnet.onSubnegotiation(99, func(telnet *telnetFilter, data []byte) {
+		received <- append([]byte{}, data...)
+	})
+	filter := telnet // What NewTelnetFilter would have returned
+	go telnet.doFilter()
+	telnetTestSkipNegotiation(t, dummy, 9)
+
+	// Split across messages, with an escaped IAC in the middle
+	dummy.Send(NewDataMessage([]byte{'a', 'b', 255, 250, 99, 1, 255}))
+	m := <-filter.FromConn()
+	assert.Equal(t, "ab", m.(DataMessage).String(), "Data before subnegotiation")
+	dummy.Send(NewDataMessage([]byte{255, 2, 255}))
+	dummy.Send(NewDataMessage([]byte{240, 'c', 'd'}))
+	m = <-filter.FromConn()
+	assert.Equal(t, "cd", m.(DataMessage).String(), "Data after subnegotiation")
+	assert.Equal(t, []byte{1, 255, 2}, <-received, "Handler called with payload")
+
+	// An IAC that isn't escaped doesn't end it early
+	dummy.Send(NewDataMessage([]byte{255, 250, 99, 4, 255, 5, 255, 240, 'h'}))
+	m = <-filter.FromConn()
+	assert.Equal(t, "h", m.(DataMessage).String(), "Data after subnegotiation")
+	assert.Equal(t, []byte{4, 255, 5}, <-received, "Unescaped IAC kept")
+
+	// Options nobody handles are eaten
+	dummy.Send(NewDataMessage([]byte{255, 250, 98, 'x', 'y', 255, 240, 'e'}))
+	m = <-filter.FromConn()
+	assert.Equal(t, "e", m.(DataMessage).String(), "Unhandled subnegotiation not passed on")
+
+	// So are ones that go on too long
+	long := append([]byte{255, 250, 99}, make([]byte, telnetMaxSubnegotiation+10)...)
+	long = append(long, 255, 240, 'f')
+	dummy.Send(NewDataMessage(long))
+	m = <-filter.FromConn()
+	assert.Equal(t, "f", m.(DataMessage).String(), "Overlong subnegotiation not passed on")
+	assert.Equal(t, 0, len(received), "Overlong subnegotiation not handled")
+
+	close(filter.ToConn())
+}
+
+func TestTelnetNaws(t *testing.T) {
+	t.Parallel()
+
+	dummy, err := NewDummyConnection("0")
+	assert.Equal(t, nil, err, "No dummy connection error")
+
+	telnet, err := NewTelnetFilter(dummy)
+	assert.Equal(t, nil, err, "No telnet filter error")
+	telnetTestSkipNegotiation(t, dummy, 9)
+
+	// WILL NAWS answers our DO, so needs no reply
+	dummy.Send(NewDataMessage([]byte{255, 251, 31, 255, 250, 31, 0, 80, 0, 24, 255, 240}))
+	m := <-telnet.FromConn()
+	assert.Equal(t, WindowSizeMessage{Width: 80, Height: 24}, m, "Initial window size")
+
+	// A resize, with an escaped 255 width split across messages
+	dummy.Send(NewDataMessage([]byte{255, 250, 31, 0, 255}))
+	dummy.Send(NewDataMessage([]byte{255, 0, 50, 255, 240}))
+	m = <-telnet.FromConn()
+	assert.Equal(t, WindowSizeMessage{Width: 255, Height: 50}, m, "Resized window")
+
+	// Text and a resize together arrive in that order
+	dummy.Send(NewDataMessage([]byte{'a', 255, 250, 31, 0, 132, 0, 50, 255, 240}))
+	m = <-telnet.FromConn()
+	assert.Equal(t, "a", m.(DataMessage).String(), "Text first")
+	m = <-telnet.FromConn()
+	assert.Equal(t, WindowSizeMessage{Width: 132, Height: 50}, m, "Then the resize")
+
+	// Nonsense is ignored
+	dummy.Send(NewDataMessage([]byte{255, 250, 31, 0, 80, 255, 240, 'a'}))
+	m = <-telnet.FromConn()
+	assert.Equal(t, "a", m.(DataMessage).String(), "Short window size ignored")
+
+	close(telnet.ToConn())
+}
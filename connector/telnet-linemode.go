@@ -0,0 +1,255 @@
+package connector
+
+import (
+	"log"
+)
+
+// LINEMODE (RFC 1184) lets the client edit a line before sending it,
+// rather than sending every keystroke and waiting for us to echo it.
+// We only ask for it when an app sends a LineModeMessage.  In edit
+// mode we also ask the client (with FORWARDMASK) to send its line
+// early when it sees a control character it doesn't edit with.
+
+const (
+	telnetLineModeMode        byte = 1
+	telnetLineModeForwardMask byte = 2
+	telnetLineModeSlc         byte = 3
+
+	telnetModeEdit    byte = 1
+	telnetModeTrapSig byte = 2
+	telnetModeAck     byte = 4
+)
+
+// SLC (special line character) functions and levels
+const (
+	telnetSlcAyt   byte = 5
+	telnetSlcAbort byte = 7
+	telnetSlcEof   byte = 8
+	telnetSlcSusp  byte = 9
+	telnetSlcEc    byte = 10
+	telnetSlcEl    byte = 11
+
+	telnetSlcNoSupport byte = 0
+	telnetSlcValue     byte = 2
+	telnetSlcDefault   byte = 3
+	telnetSlcLevelBits byte = 3
+	telnetSlcAck       byte = 128
+
+	telnetSlcFunctions = 18 // Numbered from 1
+)
+
+type telnetSlc struct {
+	modifiers byte
+	value     byte
+}
+
+// What we offer a client that asks for our defaults
+var telnetSlcDefaults = map[byte]byte{
+	3:              3,   // IP: ^C
+	4:              15,  // AO: ^O
+	telnetSlcAyt:   20,  // ^T
+	telnetSlcAbort: 28,  // ^\
+	telnetSlcEof:   4,   // ^D
+	telnetSlcSusp:  26,  // ^Z
+	telnetSlcEc:    127, // DEL
+	telnetSlcEl:    21,  // ^U
+	12:             23,  // EW: ^W
+	13:             18,  // RP: ^R
+	14:             22,  // LNEXT: ^V
+	15:             17,  // XON: ^Q
+	16:             19,  // XOFF: ^S
+}
+
+// Telnet commands a client in line mode sends in place of special
+// characters, and the SLC function whose character we pass on
+var telnetSlcCommands = map[byte]byte{
+	236: telnetSlcEof,
+	237: telnetSlcSusp,
+	238: telnetSlcAbort,
+	246: telnetSlcAyt,
+	247: telnetSlcEc,
+	248: telnetSlcEl,
+}
+
+func (telnet *telnetFilter) setLineMode(mode LineModeMessage) {
+	// Called when an app asks for a mode.  We stop echoing when the
+	// client edits lines itself, as it echoes them too.
+	telnet.lineMode = mode
+	telnet.lineModeReport = true
+	telnet.requestOption(telnetOptEcho, false, !mode.Edit)
+
+	if telnet.optionEnabled(telnetOptLineMode, true) {
+		telnet.sendLineMode()
+	} else {
+		telnet.requestOption(telnetOptLineMode, true, true)
+	}
+}
+
+func (telnet *telnetFilter) lineModeChanged(enabled bool) {
+	if enabled {
+		telnet.sendLineMode()
+		return
+	}
+
+	// Without LINEMODE, we're back to a character at a time, which
+	// we echo.  Whatever mode we wanted no longer applies either.
+	telnet.lineMode = LineModeMessage{}
+	telnet.forwardMask = false
+	telnet.requestOption(telnetOptEcho, false, true)
+	if telnet.lineModeReport {
+		telnet.lineModeReport = false
+		telnet.fromClient <- LineModeMessage{}
+	}
+}
+
+func (telnet *telnetFilter) sendLineMode() {
+	var mask byte
+	if telnet.lineMode.Edit {
+		mask |= telnetModeEdit
+	}
+	if telnet.lineMode.TrapSig {
+		mask |= telnetModeTrapSig
+	}
+	telnet.sendSubnegotiation(telnetOptLineMode, []byte{telnetLineModeMode, mask})
+
+	if telnet.lineMode.Edit {
+		telnet.sendForwardMask()
+	} else if telnet.forwardMask {
+		telnet.forwardMask = false
+		telnet.sendSubnegotiation(telnetOptLineMode, []byte{telnetDont, telnetLineModeForwardMask})
+	}
+}
+
+func (telnet *telnetFilter) sendForwardMask() {
+	// One bit per character, most significant bit first.  We only
+	// need the control characters, so leave off the zero octets
+	// for the rest.
+	forward := make(map[byte]bool)
+	for c := byte(1); c < 32; c++ {
+		forward[c] = true
+	}
+	delete(forward, '\r')
+	delete(forward, '\n')
+	for function := byte(1); function <= telnetSlcFunctions; function++ {
+		delete(forward, telnet.slcChar(function))
+	}
+
+	mask := make([]byte, 4)
+	for c := range forward {
+		mask[c/8] |= 0x80 >> (c % 8)
+	}
+
+	sb := append([]byte{telnetDo, telnetLineModeForwardMask}, mask...)
+	telnet.sendSubnegotiation(telnetOptLineMode, sb)
+}
+
+func (telnet *telnetFilter) handleLineMode(data []byte) {
+	if len(data) < 2 {
+		return
+	}
+
+	switch data[0] {
+	case telnetLineModeMode:
+		telnet.handleLineModeMode(data[1])
+	case telnetLineModeSlc:
+		telnet.handleSlc(data[1:])
+	case telnetWill, telnetWont:
+		// The client's answer to our DO FORWARDMASK
+		if data[1] == telnetLineModeForwardMask {
+			telnet.forwardMask = data[0] == telnetWill
+		}
+	default:
+		log.Printf("Ignoring LINEMODE command (%d)", data[0])
+	}
+}
+
+func (telnet *telnetFilter) handleLineModeMode(mask byte) {
+	mode := LineModeMessage{}
+	mode.Edit = mask&telnetModeEdit != 0
+	mode.TrapSig = mask&telnetModeTrapSig != 0
+
+	if mask&telnetModeAck != 0 {
+		// The client has switched to a mode we asked for
+		telnet.lineMode = mode
+		if telnet.lineModeReport {
+			telnet.lineModeReport = false
+			telnet.fromClient <- mode
+		}
+		return
+	}
+
+	// The client wants a mode of its own, which we go along with,
+	// echoing only if it doesn't
+	telnet.lineMode = mode
+	telnet.lineModeReport = false
+	telnet.sendSubnegotiation(telnetOptLineMode, []byte{telnetLineModeMode, mask | telnetModeAck})
+	telnet.requestOption(telnetOptEcho, false, !mode.Edit)
+	telnet.fromClient <- mode
+}
+
+func (telnet *telnetFilter) handleSlc(data []byte) {
+	// The client tells us its special characters as triplets of
+	// function, modifiers and character.  We agree with whatever it
+	// has, and offer our own when it asks for defaults.
+	reply := make([]byte, 0)
+
+	for i := 0; i+2 < len(data); i += 3 {
+		function := data[i]
+		slc := telnetSlc{modifiers: data[i+1], value: data[i+2]}
+
+		if slc.modifiers&telnetSlcAck != 0 {
+			slc.modifiers &^= telnetSlcAck
+			telnet.slc[function] = slc
+			continue
+		}
+
+		if slc.modifiers&telnetSlcLevelBits == telnetSlcDefault {
+			if function == 0 {
+				// All of them
+				for function := byte(1); function <= telnetSlcFunctions; function++ {
+					reply = append(reply, telnet.slcDefault(function)...)
+				}
+			} else {
+				reply = append(reply, telnet.slcDefault(function)...)
+			}
+			continue
+		}
+
+		current, ok := telnet.slc[function]
+		if ok && current == slc {
+			continue
+		}
+		telnet.slc[function] = slc
+		reply = append(reply, function, slc.modifiers|telnetSlcAck, slc.value)
+	}
+
+	if len(reply) > 0 {
+		telnet.sendSubnegotiation(telnetOptLineMode, append([]byte{telnetLineModeSlc}, reply...))
+
+		// The characters the client edits with may have changed
+		if telnet.lineMode.Edit {
+			telnet.sendForwardMask()
+		}
+	}
+}
+
+func (telnet *telnetFilter) slcDefault(function byte) []byte {
+	slc := telnetSlc{modifiers: telnetSlcNoSupport}
+	value, ok := telnetSlcDefaults[function]
+	if ok {
+		slc = telnetSlc{modifiers: telnetSlcValue, value: value}
+	}
+
+	telnet.slc[function] = slc
+	return []byte{function, slc.modifiers, slc.value}
+}
+
+func (telnet *telnetFilter) slcChar(function byte) byte {
+	// The character the client uses for a special function, or
+	// ours if it hasn't said
+	slc, ok := telnet.slc[function]
+	if ok && slc.modifiers&telnetSlcLevelBits != telnetSlcNoSupport {
+		return slc.value
+	}
+	return telnetSlcDefaults[function]
+}
@@ -0,0 +1,139 @@
+package connector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTelnetLineMode(t *testing.T) {
+	t.Parallel()
+
+	dummy, err := NewDummyConnection("0")
+	assert.Equal(t, nil, err, "No dummy connection error")
+
+	telnet, err := NewTelnetFilter(dummy)
+	assert.Equal(t, nil, err, "No telnet filter error")
+	telnetTestSkipNegotiation(t, dummy, 9)
+	dummy.Send(NewDataMessage([]byte{255, 253, 0, 255, 253, 1, 255, 253, 3})) // DO BINARY, ECHO, SGA
+
+	// The client echoes in line mode, so we stop
+	telnet.ToConn() <- LineModeMessage{Edit: true, TrapSig: true}
+	o := telnetTestRecv(t, dummy.ToConn())
+	assert.Equal(t, []byte{255, 252, 1}, o.(DataMessage).Data, "Sent WONT ECHO")
+	o = telnetTestRecv(t, dummy.ToConn())
+	assert.Equal(t, []byte{255, 253, 34}, o.(DataMessage).Data, "Sent DO LINEMODE")
+	dummy.Send(NewDataMessage([]byte{255, 254, 1, 255, 251, 34})) // DONT ECHO, WILL LINEMODE
+	o = telnetTestRecv(t, dummy.ToConn())
+	assert.Equal(t, []byte{255, 250, 34, 1, 3, 255, 240}, o.(DataMessage).Data, "Sent MODE EDIT|TRAPSIG")
+	o = telnetTestRecv(t, dummy.ToConn())
+	assert.Equal(t, []byte{255, 250, 34, 253, 2, 0x67, 0xda, 0x80, 0xd7, 255, 240}, o.(DataMessage).Data, "Sent DO FORWARDMASK")
+	dummy.Send(NewDataMessage([]byte{255, 250, 34, 251, 2, 255, 240})) // WILL FORWARDMASK
+
+	// Its special characters, which we agree to
+	slc := []byte{255, 250, 34, 3, 3, 2, 3, 10, 2, 8, 8, 0, 0, 255, 240}
+	dummy.Send(NewDataMessage(slc))
+	o = telnetTestRecv(t, dummy.ToConn())
+	assert.Equal(t, []byte{255, 250, 34, 3, 3, 130, 3, 10, 130, 8, 8, 128, 0, 255, 240}, o.(DataMessage).Data, "Acknowledged SLC")
+	o = telnetTestRecv(t, dummy.ToConn())
+	assert.Equal(t, []byte{255, 250, 34, 253, 2, 0x67, 0x5a, 0x80, 0xd7, 255, 240}, o.(DataMessage).Data, "Backspace no longer forwards")
+	dummy.Send(NewDataMessage(slc))
+
+	dummy.Send(NewDataMessage([]byte{255, 250, 34, 1, 7, 255, 240})) // MODE EDIT|TRAPSIG|ACK
+	m := telnetTestRecvFromConn(t, telnet)
+	assert.Equal(t, LineModeMessage{Edit: true, TrapSig: true}, m, "Client in line mode")
+
+	// Erase character is the client's, and EOF (which it doesn't
+	// have) is ours
+	dummy.Send(NewDataMessage([]byte{255, 247, 255, 236, 'x'}))
+	m = telnetTestRecvFromConn(t, telnet)
+	assert.Equal(t, []byte{8, 4, 'x'}, m.(DataMessage).Data, "Special characters passed on")
+
+	// Back to a character at a time
+	telnet.ToConn() <- LineModeMessage{}
+	o = telnetTestRecv(t, dummy.ToConn())
+	assert.Equal(t, []byte{255, 251, 1}, o.(DataMessage).Data, "Sent WILL ECHO")
+	o = telnetTestRecv(t, dummy.ToConn())
+	assert.Equal(t, []byte{255, 250, 34, 1, 0, 255, 240}, o.(DataMessage).Data, "Sent MODE 0")
+	o = telnetTestRecv(t, dummy.ToConn())
+	assert.Equal(t, []byte{255, 250, 34, 254, 2, 255, 240}, o.(DataMessage).Data, "Sent DONT FORWARDMASK")
+	dummy.Send(NewDataMessage([]byte{255, 253, 1, 255, 250, 34, 1, 4, 255, 240}))
+	m = telnetTestRecvFromConn(t, telnet)
+	assert.Equal(t, LineModeMessage{}, m, "Client in character mode")
+
+	close(telnet.ToConn())
+}
+
+func TestTelnetLineModeRefused(t *testing.T) {
+	t.Parallel()
+
+	dummy, err := NewDummyConnection("0")
+	assert.Equal(t, nil, err, "No dummy connection error")
+
+	telnet, err := NewTelnetFilter(dummy)
+	assert.Equal(t, nil, err, "No telnet filter error")
+	telnetTestSkipNegotiation(t, dummy, 9)
+	dummy.Send(NewDataMessage([]byte{255, 253, 0, 255, 253, 1, 255, 253, 3})) // DO BINARY, ECHO, SGA
+
+	telnet.ToConn() <- LineModeMessage{Edit: true}
+	o := telnetTestRecv(t, dummy.ToConn())
+	assert.Equal(t, []byte{255, 252, 1}, o.(DataMessage).Data, "Sent WONT ECHO")
+	o = telnetTestRecv(t, dummy.ToConn())
+	assert.Equal(t, []byte{255, 253, 34}, o.(DataMessage).Data, "Sent DO LINEMODE")
+
+	// Nobody would echo in character mode, so we start again
+	dummy.Send(NewDataMessage([]byte{255, 254, 1, 255, 252, 34})) // DONT ECHO, WONT LINEMODE
+	o = telnetTestRecv(t, dummy.ToConn())
+	assert.Equal(t, []byte{255, 251, 1}, o.(DataMessage).Data, "Sent WILL ECHO")
+	m := telnetTestRecvFromConn(t, telnet)
+	assert.Equal(t, LineModeMessage{}, m, "Client stays in character mode")
+	dummy.Send(NewDataMessage([]byte{255, 253, 1})) // DO ECHO
+
+	// The mode we wanted is forgotten, so a client that changes
+	// its mind gets character mode
+	dummy.Send(NewDataMessage([]byte{255, 251, 34})) // WILL LINEMODE
+	o = telnetTestRecv(t, dummy.ToConn())
+	assert.Equal(t, []byte{255, 253, 34}, o.(DataMessage).Data, "Sent DO LINEMODE")
+	o = telnetTestRecv(t, dummy.ToConn())
+	assert.Equal(t, []byte{255, 250, 34, 1, 0, 255, 240}, o.(DataMessage).Data, "Sent MODE 0")
+
+	close(telnet.ToConn())
+}
+
+func TestTelnetLineModeClient(t *testing.T) {
+	t.Parallel()
+
+	dummy, err := NewDummyConnection("0")
+	assert.Equal(t, nil, err, "No dummy connection error")
+
+	telnet, err := NewTelnetFilter(dummy)
+	assert.Equal(t, nil, err, "No telnet filter error")
+	telnetTestSkipNegotiation(t, dummy, 9)
+	dummy.Send(NewDataMessage([]byte{255, 253, 0, 255, 253, 1, 255, 253, 3})) // DO BINARY, ECHO, SGA
+
+	// A client offering LINEMODE by itself starts in character mode
+	dummy.Send(NewDataMessage([]byte{255, 251, 34}))
+	o := telnetTestRecv(t, dummy.ToConn())
+	assert.Equal(t, []byte{255, 253, 34}, o.(DataMessage).Data, "Sent DO LINEMODE")
+	o = telnetTestRecv(t, dummy.ToConn())
+	assert.Equal(t, []byte{255, 250, 34, 1, 0, 255, 240}, o.(DataMessage).Data, "Sent MODE 0")
+
+	// Then asks for our special characters
+	dummy.Send(NewDataMessage([]byte{255, 250, 34, 3, 0, 3, 0, 255, 240}))
+	o = telnetTestRecv(t, dummy.ToConn())
+	data := o.(DataMessage).Data
+	assert.Equal(t, []byte{255, 250, 34, 3}, data[:4], "Sent SLC")
+	assert.Equal(t, 4+3*telnetSlcFunctions+2, len(data), "Sent every function")
+	assert.Equal(t, []byte{1, 0, 0, 2, 0, 0, 3, 2, 3}, data[4:13], "SYNCH and BRK unsupported, IP is ^C")
+
+	// And picks a mode of its own
+	dummy.Send(NewDataMessage([]byte{255, 250, 34, 1, 1, 255, 240}))
+	o = telnetTestRecv(t, dummy.ToConn())
+	assert.Equal(t, []byte{255, 250, 34, 1, 5, 255, 240}, o.(DataMessage).Data, "Acknowledged MODE EDIT")
+	o = telnetTestRecv(t, dummy.ToConn())
+	assert.Equal(t, []byte{255, 252, 1}, o.(DataMessage).Data, "Sent WONT ECHO, as the client echoes")
+	m := telnetTestRecvFromConn(t, telnet)
+	assert.Equal(t, LineModeMessage{Edit: true}, m, "Client in line mode")
+
+	close(telnet.ToConn())
+}
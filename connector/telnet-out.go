@@ -0,0 +1,90 @@
+package connector
+
+import (
+	"encoding/binary"
+)
+
+const (
+	telnetTerminalTypeIs   byte = 0
+	telnetTerminalTypeSend byte = 1
+)
+
+func NewTelnetClientFilter(conn Connection, terminalType string) (telnetFilter, error) {
+	// A telnet filter that plays the client, for use on outbound
+	// connections to telnet servers.  Window sizes sent to
+	// ToConn() are passed on to the server, as is terminalType
+	// (unless it is empty).
+	telnet := telnetFilter{}
+
+	telnet.inboundConnection = conn
+	telnet.id = conn.Id() + "-(telnet-client)"
+	telnet.client = true
+	telnet.terminalType = terminalType
+	telnet.fillDefaults()
+	telnet.onSubnegotiation(telnetOptTerminalType, (*telnetFilter).clientHandleTerminalType)
+
+	go telnet.doFilter()
+
+	return telnet, nil
+}
+
+func (telnet *telnetFilter) clientInitNegotiate() {
+	// We'd like binary mode both ways, the server to do the echoing,
+	// no go-aheads, and to tell the server about our terminal.
+	telnet.requestOption(telnetOptBinary, false, true)
+	telnet.requestOption(telnetOptSuppressGoAhead, false, true)
+	telnet.requestOption(telnetOptNaws, false, true)
+	if telnet.terminalType != "" {
+		telnet.requestOption(telnetOptTerminalType, false, true)
+	}
+
+	telnet.requestOption(telnetOptBinary, true, true)
+	telnet.requestOption(telnetOptEcho, true, true)
+	telnet.requestOption(telnetOptSuppressGoAhead, true, true)
+}
+
+func (telnet *telnetFilter) sendWindowSize() {
+	if !telnet.optionEnabled(telnetOptNaws, false) || telnet.windowSize == nil {
+		return
+	}
+
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint16(data[0:2], uint16(telnet.windowSize.Width))
+	binary.BigEndian.PutUint16(data[2:4], uint16(telnet.windowSize.Height))
+	telnet.sendSubnegotiation(telnetOptNaws, data)
+}
+
+func (telnet *telnetFilter) clientAcceptOption(opt telnetOption, remote bool) bool {
+	if remote {
+		// The server echoing is exactly what we want
+		switch opt {
+		case telnetOptBinary, telnetOptEcho, telnetOptSuppressGoAhead:
+			return true
+		}
+		return false
+	}
+
+	switch opt {
+	case telnetOptBinary, telnetOptSuppressGoAhead, telnetOptNaws:
+		return true
+	case telnetOptTerminalType:
+		return telnet.terminalType != ""
+	}
+	return false
+}
+
+func (telnet *telnetFilter) clientOptionChanged(opt telnetOption, remote bool, enabled bool) {
+	// The server wants to know our size, and we might already know
+	// it.
+	if opt == telnetOptNaws && !remote && enabled {
+		telnet.sendWindowSize()
+	}
+}
+
+func (telnet *telnetFilter) clientHandleTerminalType(data []byte) {
+	if len(data) == 0 || data[0] != telnetTerminalTypeSend || telnet.terminalType == "" {
+		return
+	}
+	is := append([]byte{telnetTerminalTypeIs}, []byte(telnet.terminalType)...)
+	telnet.sendSubnegotiation(telnetOptTerminalType, is)
+}
@@ -0,0 +1,77 @@
+package connector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTelnetClient(t *testing.T) {
+	t.Parallel()
+
+	dummy, err := NewDummyConnection("0")
+	assert.Equal(t, nil, err, "No dummy connection error")
+
+	telnet, err := NewTelnetClientFilter(dummy, "xterm")
+	assert.Equal(t, nil, err, "No telnet filter error")
+	assert.Equal(t, dummy.Id()+"-(telnet-client)", telnet.Id(), "Telnet ID is proper")
+
+	initial := [][]byte{
+		{255, 251, 0},  // WILL BINARY
+		{255, 251, 3},  // WILL SUPPRESS GO AHEAD
+		{255, 251, 31}, // WILL NAWS
+		{255, 251, 24}, // WILL TERMINAL TYPE
+		{255, 253, 0},  // DO BINARY
+		{255, 253, 1},  // DO ECHO
+		{255, 253, 3},  // DO SUPPRESS GO AHEAD
+	}
+	for _, expected := range initial {
+		o, ok := dummy.Recv()
+		assert.True(t, ok, "No dummy receive error")
+		assert.Equal(t, expected, o.(DataMessage).Data, "Initial negotiation")
+	}
+
+	// Our user's window size is held until the server asks for it
+	telnet.ToConn() <- WindowSizeMessage{Width: 80, Height: 24}
+
+	dummy.Send(NewDataMessage([]byte{255, 253, 31})) // DO NAWS
+	o, ok := dummy.Recv()
+	assert.True(t, ok, "No dummy receive error")
+	assert.Equal(t, []byte{255, 250, 31, 0, 80, 0, 24, 255, 240}, o.(DataMessage).Data, "Sent window size")
+
+	telnet.ToConn() <- WindowSizeMessage{Width: 255, Height: 50}
+	o, ok = dummy.Recv()
+	assert.True(t, ok, "No dummy receive error")
+	assert.Equal(t, []byte{255, 250, 31, 0, 255, 255, 0, 50, 255, 240}, o.(DataMessage).Data, "Sent window size change")
+
+	// SB TERMINAL-TYPE SEND, split across messages
+	dummy.Send(NewDataMessage([]byte{255, 253, 24, 255, 250, 24}))
+	dummy.Send(NewDataMessage([]byte{1, 255}))
+	dummy.Send(NewDataMessage([]byte{240}))
+	o, ok = dummy.Recv()
+	assert.True(t, ok, "No dummy receive error")
+	assert.Equal(t, append([]byte{255, 250, 24, 0}, []byte("xterm")...), o.(DataMessage).Data[:9], "Sent terminal type")
+	assert.Equal(t, []byte{255, 240}, o.(DataMessage).Data[9:], "Terminal type ended")
+
+	dummy.Send(NewDataMessage([]byte{255, 253, 99})) // DO something unknown
+	o, ok = dummy.Recv()
+	assert.True(t, ok, "No dummy receive error")
+	assert.Equal(t, []byte{255, 252, 99}, o.(DataMessage).Data, "Refused unknown option")
+
+	dummy.Send(NewDataMessage([]byte{255, 253, 1})) // DO ECHO
+	o, ok = dummy.Recv()
+	assert.True(t, ok, "No dummy receive error")
+	assert.Equal(t, []byte{255, 252, 1}, o.(DataMessage).Data, "Refused to echo")
+
+	// Finish negotiation so data flows
+	dummy.Send(NewDataMessage([]byte{255, 253, 0, 255, 253, 3, 255, 251, 0, 255, 251, 1, 255, 251, 3}))
+
+	dummy.Send(NewDataMessageFromString("login: "))
+	m := <-telnet.FromConn()
+	assert.Equal(t, "login: ", m.(DataMessage).String(), "Data from server")
+
+	telnet.ToConn() <- NewDataMessageFromString("joel")
+	o, ok = dummy.Recv()
+	assert.True(t, ok, "No dummy receive error")
+	assert.Equal(t, "joel", o.(DataMessage).String(), "Data to server")
+}
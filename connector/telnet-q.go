@@ -0,0 +1,177 @@
+package connector
+
+// Option negotiation, using the Q method from RFC 1143.  Each option
+// has two sides: whether we do it ("us", WILL/WONT) and whether the
+// other end does ("him", DO/DONT).  Each side only ever answers a
+// request that would change its state, so the two ends can't get
+// stuck acknowledging each other's acknowledgements.
+
+type telnetQState byte
+
+const (
+	telnetQNo telnetQState = iota
+	telnetQYes
+	telnetQWantNo  // Sent WONT or DONT, waiting for the answer
+	telnetQWantYes // Sent WILL or DO, waiting for the answer
+)
+
+type telnetQSide struct {
+	state     telnetQState
+	opposite  bool // Ask for the reverse once the current request is answered
+	requested bool // An app asked for a change, and wants to hear how it settles
+}
+
+type telnetQOption struct {
+	us  telnetQSide
+	him telnetQSide
+}
+
+func (telnet *telnetFilter) qSide(opt telnetOption, remote bool) *telnetQSide {
+	q, ok := telnet.options[opt]
+	if !ok {
+		q = &telnetQOption{}
+		telnet.options[opt] = q
+	}
+
+	if remote {
+		return &q.him
+	}
+	return &q.us
+}
+
+func (telnet *telnetFilter) optionEnabled(opt telnetOption, remote bool) bool {
+	return telnet.qSide(opt, remote).state == telnetQYes
+}
+
+func (telnet *telnetFilter) negotiating() bool {
+	// True while we're waiting to hear if we may do something, which
+	// may change how we should send data.
+	for _, q := range telnet.options {
+		if q.us.state == telnetQWantNo || q.us.state == telnetQWantYes {
+			return true
+		}
+	}
+	return false
+}
+
+func (telnet *telnetFilter) sendOption(opt telnetOption, remote bool, enable bool) {
+	if remote && enable {
+		telnet.sendDo(opt)
+	} else if remote {
+		telnet.sendDont(opt)
+	} else if enable {
+		telnet.sendWill(opt)
+	} else {
+		telnet.sendWont(opt)
+	}
+}
+
+func (telnet *telnetFilter) requestOption(opt telnetOption, remote bool, enable bool) {
+	// Ask for an option to be turned on or off, on our side or the
+	// other end's.
+	side := telnet.qSide(opt, remote)
+	was := side.state
+
+	if enable {
+		switch side.state {
+		case telnetQNo:
+			side.state = telnetQWantYes
+			telnet.sendOption(opt, remote, true)
+		case telnetQWantNo:
+			side.opposite = true
+		case telnetQWantYes:
+			side.opposite = false
+		}
+	} else {
+		switch side.state {
+		case telnetQYes:
+			side.state = telnetQWantNo
+			telnet.sendOption(opt, remote, false)
+		case telnetQWantNo:
+			side.opposite = false
+		case telnetQWantYes:
+			side.opposite = true
+		}
+	}
+
+	telnet.optionSettled(opt, remote, was)
+}
+
+func (telnet *telnetFilter) receiveEnable(opt telnetOption, remote bool) {
+	// The other end sent WILL (remote) or DO (not remote)
+	side := telnet.qSide(opt, remote)
+	was := side.state
+
+	switch side.state {
+	case telnetQNo:
+		if telnet.acceptOption(opt, remote) {
+			side.state = telnetQYes
+			telnet.sendOption(opt, remote, true)
+		} else {
+			telnet.sendOption(opt, remote, false)
+		}
+	case telnetQWantNo:
+		// They shouldn't say yes to a no, but we can't stop them
+		if side.opposite {
+			side.state = telnetQYes
+			side.opposite = false
+		} else {
+			side.state = telnetQNo
+		}
+	case telnetQWantYes:
+		if side.opposite {
+			side.state = telnetQWantNo
+			side.opposite = false
+			telnet.sendOption(opt, remote, false)
+		} else {
+			side.state = telnetQYes
+		}
+	}
+
+	telnet.optionSettled(opt, remote, was)
+}
+
+func (telnet *telnetFilter) receiveDisable(opt telnetOption, remote bool) {
+	// The other end sent WONT (remote) or DONT (not remote)
+	side := telnet.qSide(opt, remote)
+	was := side.state
+
+	switch side.state {
+	case telnetQYes:
+		side.state = telnetQNo
+		telnet.sendOption(opt, remote, false)
+	case telnetQWantNo:
+		if side.opposite {
+			side.state = telnetQWantYes
+			side.opposite = false
+			telnet.sendOption(opt, remote, true)
+		} else {
+			side.state = telnetQNo
+		}
+	case telnetQWantYes:
+		side.state = telnetQNo
+		side.opposite = false
+	}
+
+	telnet.optionSettled(opt, remote, was)
+}
+
+func (telnet *telnetFilter) optionSettled(opt telnetOption, remote bool, was telnetQState) {
+	side := telnet.qSide(opt, remote)
+	enabled := side.state == telnetQYes
+
+	// Refusals count as changes, so whoever was waiting finds out
+	if (was == telnetQYes) != enabled || (was == telnetQWantYes && side.state == telnetQNo) {
+		telnet.optionChanged(opt, remote, enabled)
+	}
+
+	if side.requested && (side.state == telnetQYes || side.state == telnetQNo) {
+		side.requested = false
+		telnet.fromClient <- TelnetOptionMessage{Option: opt.Byte(), Remote: remote, Enabled: enabled}
+	}
+
+	// Data held back while we found out how to send it can go now
+	if !remote && !telnet.negotiating() {
+		telnet.flushWriteBuffer()
+	}
+}
@@ -0,0 +1,104 @@
+package connector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func telnetTestRecv(t *testing.T, c chan message) message {
+	// The filter blocks writing anything we don't read, so an
+	// unexpected message shows up as nothing arriving where we
+	// expected it.
+	select {
+	case m := <-c:
+		return m
+	case <-time.After(time.Second):
+		t.Fatal("Nothing received from filter")
+	}
+	return nil
+}
+
+func telnetTestRecvFromConn(t *testing.T, telnet telnetFilter) message {
+	return telnetTestRecv(t, telnet.FromConn())
+}
+
+func TestTelnetQNoLoops(t *testing.T) {
+	t.Parallel()
+
+	dummy, err := NewDummyConnection("0")
+	assert.Equal(t, nil, err, "No dummy connection error")
+
+	telnet, err := NewTelnetFilter(dummy)
+	assert.Equal(t, nil, err, "No telnet filter error")
+	telnetTestSkipNegotiation(t, dummy, 9)
+
+	// Answers to our requests, then the same again, need no reply
+	dummy.Send(NewDataMessage([]byte{255, 251, 0, 255, 253, 1, 255, 251, 0, 255, 253, 1, 'a'}))
+	m := telnetTestRecvFromConn(t, telnet)
+	assert.Equal(t, "a", m.(DataMessage).String(), "Repeated answers ignored")
+
+	// Our first DONT ECHO needs no answer, so a WILL ECHO is a
+	// request like any other, and refused every time
+	for i := 0; i < 2; i++ {
+		dummy.Send(NewDataMessage([]byte{255, 251, 1, 'b'}))
+		o, ok := dummy.Recv()
+		assert.True(t, ok, "No dummy receive error")
+		assert.Equal(t, []byte{255, 254, 1}, o.(DataMessage).Data, "Refused WILL ECHO")
+		m = telnetTestRecvFromConn(t, telnet)
+		assert.Equal(t, "b", m.(DataMessage).String(), "Data after refusal")
+	}
+
+	// A WONT for something that is already off is ignored
+	dummy.Send(NewDataMessage([]byte{255, 252, 1, 255, 252, 99, 'c'}))
+	m = telnetTestRecvFromConn(t, telnet)
+	assert.Equal(t, "c", m.(DataMessage).String(), "WONT ignored")
+
+	close(telnet.ToConn())
+}
+
+func TestTelnetQRequest(t *testing.T) {
+	t.Parallel()
+
+	dummy, err := NewDummyConnection("0")
+	assert.Equal(t, nil, err, "No dummy connection error")
+
+	telnet, err := NewTelnetFilter(dummy)
+	assert.Equal(t, nil, err, "No telnet filter error")
+	telnetTestSkipNegotiation(t, dummy, 9)
+	dummy.Send(NewDataMessage([]byte{255, 253, 0, 255, 253, 1, 255, 253, 3})) // DO BINARY, ECHO, SGA
+
+	// Turn echo off, and hear about it once the client agrees
+	telnet.ToConn() <- TelnetOptionRequestMessage{Option: 1, Enable: false}
+	o, ok := dummy.Recv()
+	assert.True(t, ok, "No dummy receive error")
+	assert.Equal(t, []byte{255, 252, 1}, o.(DataMessage).Data, "Sent WONT ECHO")
+	dummy.Send(NewDataMessage([]byte{255, 254, 1})) // DONT ECHO
+	m := telnetTestRecvFromConn(t, telnet)
+	assert.Equal(t, TelnetOptionMessage{Option: 1, Enabled: false}, m, "Echo off")
+
+	// Change our minds before the client answers
+	telnet.ToConn() <- TelnetOptionRequestMessage{Option: 1, Enable: true}
+	o, ok = dummy.Recv()
+	assert.True(t, ok, "No dummy receive error")
+	assert.Equal(t, []byte{255, 251, 1}, o.(DataMessage).Data, "Sent WILL ECHO")
+	telnet.ToConn() <- TelnetOptionRequestMessage{Option: 1, Enable: false}
+	telnet.ToConn() <- TelnetOptionRequestMessage{Option: 1, Enable: true}
+	telnet.ToConn() <- TelnetOptionRequestMessage{Option: 1, Enable: false}
+	dummy.Send(NewDataMessage([]byte{255, 253, 1})) // DO ECHO
+	o, ok = dummy.Recv()
+	assert.True(t, ok, "No dummy receive error")
+	assert.Equal(t, []byte{255, 252, 1}, o.(DataMessage).Data, "Sent queued WONT ECHO")
+	dummy.Send(NewDataMessage([]byte{255, 254, 1})) // DONT ECHO
+	m = telnetTestRecvFromConn(t, telnet)
+	assert.Equal(t, TelnetOptionMessage{Option: 1, Enabled: false}, m, "Echo off again")
+
+	// Asking for something we are already waiting to hear about
+	telnet.ToConn() <- TelnetOptionRequestMessage{Option: 3, Remote: true, Enable: true}
+	dummy.Send(NewDataMessage([]byte{255, 251, 3})) // WILL SGA
+	m = telnetTestRecvFromConn(t, telnet)
+	assert.Equal(t, TelnetOptionMessage{Option: 3, Remote: true, Enabled: true}, m, "Suppress go ahead on")
+
+	close(telnet.ToConn())
+}
@@ -0,0 +1,97 @@
+package connector
+
+import (
+	"strconv"
+	"strings"
+)
+
+// MTTS capability bits, sent by MUD clients as a terminal type of
+// "MTTS <bits>" (https://tintin.mudhalla.net/protocols/mtts/)
+const (
+	MttsAnsi       = 1
+	MttsVt100      = 2
+	MttsUtf8       = 4
+	Mtts256Colors  = 8
+	MttsMouse      = 16
+	MttsOscColors  = 32
+	MttsScreenRead = 64
+	MttsProxy      = 128
+	MttsTrueColor  = 256
+	MttsMnes       = 512
+	MttsMslp       = 1024
+	MttsSsl        = 2048
+)
+
+// Connection attributes set from the terminal type negotiation
+const (
+	AttrTerminalType  = "terminal-type"  // The first type the client sent
+	AttrTerminalTypes = "terminal-types" // Every type, comma separated
+	AttrMtts          = "mtts"           // MTTS bits, in decimal
+)
+
+const telnetMaxTerminalTypes = 10 // Stop asking after this many
+
+func (telnet *telnetFilter) requestTerminalType() {
+	telnet.sendSubnegotiation(telnetOptTerminalType, []byte{telnetTerminalTypeSend})
+}
+
+func (telnet *telnetFilter) handleTerminalType(data []byte) {
+	// RFC 1091 clients answer each SEND with their next terminal
+	// type, repeating the last one when they run out.  Some start
+	// again from the top instead, so a repeat of any of them means
+	// we have the lot.
+	if len(data) == 0 || data[0] != telnetTerminalTypeIs || telnet.terminalTypesDone {
+		return
+	}
+	name := string(data[1:])
+
+	for _, seen := range telnet.terminalTypes {
+		if seen == name {
+			telnet.terminalTypeDone()
+			return
+		}
+	}
+
+	telnet.terminalTypes = append(telnet.terminalTypes, name)
+	if len(telnet.terminalTypes) >= telnetMaxTerminalTypes {
+		telnet.terminalTypeDone()
+		return
+	}
+	telnet.requestTerminalType()
+}
+
+func (telnet *telnetFilter) terminalTypeDone() {
+	telnet.terminalTypesDone = true
+
+	msg := TerminalTypeMessage{}
+	msg.Types = make([]string, 0)
+	for _, name := range telnet.terminalTypes {
+		bits, ok := parseMtts(name)
+		if ok {
+			msg.Mtts = bits
+		} else {
+			msg.Types = append(msg.Types, name)
+		}
+	}
+
+	if len(msg.Types) > 0 {
+		telnet.attributes.set(AttrTerminalType, msg.Types[0])
+		telnet.attributes.set(AttrTerminalTypes, strings.Join(msg.Types, ","))
+	}
+	if msg.Mtts > 0 {
+		telnet.attributes.set(AttrMtts, strconv.Itoa(msg.Mtts))
+	}
+
+	telnet.fromClient <- msg
+}
+
+func parseMtts(name string) (int, bool) {
+	if !strings.HasPrefix(name, "MTTS ") {
+		return 0, false
+	}
+	bits, err := strconv.Atoi(strings.TrimPrefix(name, "MTTS "))
+	if err != nil || bits < 0 {
+		return 0, false
+	}
+	return bits, true
+}
@@ -0,0 +1,86 @@
+package connector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func telnetTestTerminalType(t *testing.T, dummy DummyConnection, reply string) {
+	o, ok := dummy.Recv()
+	assert.True(t, ok, "No dummy receive error")
+	assert.Equal(t, []byte{255, 250, 24, 1, 255, 240}, o.(DataMessage).Data, "Sent SB TERMINAL-TYPE SEND")
+
+	is := append([]byte{255, 250, 24, 0}, []byte(reply)...)
+	dummy.Send(NewDataMessage(append(is, 255, 240)))
+}
+
+func TestTelnetTerminalType(t *testing.T) {
+	t.Parallel()
+
+	dummy, err := NewDummyConnection("0")
+	assert.Equal(t, nil, err, "No dummy connection error")
+
+	telnet, err := NewTelnetFilter(dummy)
+	assert.Equal(t, nil, err, "No telnet filter error")
+	telnetTestSkipNegotiation(t, dummy, 9)
+
+	// A MUD client, cycling through its types and then repeating the
+	// last one
+	dummy.Send(NewDataMessage([]byte{255, 251, 24})) // WILL TERMINAL TYPE
+	telnetTestTerminalType(t, dummy, "TINTIN++")
+	telnetTestTerminalType(t, dummy, "XTERM-256COLOR")
+	telnetTestTerminalType(t, dummy, "MTTS 137")
+	telnetTestTerminalType(t, dummy, "MTTS 137")
+
+	m := <-telnet.FromConn()
+	expected := TerminalTypeMessage{Types: []string{"TINTIN++", "XTERM-256COLOR"}, Mtts: 137}
+	assert.Equal(t, expected, m, "Terminal types published")
+	assert.Equal(t, MttsAnsi, m.(TerminalTypeMessage).Mtts&MttsAnsi, "Client does ANSI")
+
+	attributes := telnet.Attributes().All()
+	assert.Equal(t, "TINTIN++", attributes[AttrTerminalType], "Terminal type recorded")
+	assert.Equal(t, "TINTIN++,XTERM-256COLOR", attributes[AttrTerminalTypes], "Terminal types recorded")
+	assert.Equal(t, "137", attributes[AttrMtts], "MTTS recorded")
+
+	// Saying it again is ignored, and doesn't start another round
+	dummy.Send(NewDataMessage([]byte{255, 251, 24, 'a'}))
+	m = <-telnet.FromConn()
+	assert.Equal(t, "a", m.(DataMessage).String(), "No more terminal type requests")
+
+	// Apps holding any Connection can find them, through filters too
+	wrapped, err := NewNewlineOutFilter(telnet)
+	assert.Equal(t, nil, err, "No newline filter error")
+	found, ok := ConnectionAttributes(wrapped)
+	assert.True(t, ok, "Attributes found through filter")
+	assert.Equal(t, attributes, found.All(), "Same attributes through filter")
+	_, ok = ConnectionAttributes(dummy)
+	assert.False(t, ok, "No attributes on plain connection")
+
+	close(wrapped.ToConn())
+}
+
+func TestTelnetTerminalTypeSingle(t *testing.T) {
+	t.Parallel()
+
+	dummy, err := NewDummyConnection("0")
+	assert.Equal(t, nil, err, "No dummy connection error")
+
+	telnet, err := NewTelnetFilter(dummy)
+	assert.Equal(t, nil, err, "No telnet filter error")
+	telnetTestSkipNegotiation(t, dummy, 9)
+
+	dummy.Send(NewDataMessage([]byte{255, 251, 24})) // WILL TERMINAL TYPE
+	telnetTestTerminalType(t, dummy, "VT100")
+	telnetTestTerminalType(t, dummy, "VT100")
+
+	m := <-telnet.FromConn()
+	assert.Equal(t, TerminalTypeMessage{Types: []string{"VT100"}}, m, "Terminal type published")
+	value, ok := telnet.Attributes().Get(AttrTerminalType)
+	assert.True(t, ok, "Terminal type recorded")
+	assert.Equal(t, "VT100", value, "Terminal type recorded")
+	_, ok = telnet.Attributes().Get(AttrMtts)
+	assert.False(t, ok, "No MTTS recorded")
+
+	close(telnet.ToConn())
+}
@@ -0,0 +1,66 @@
+package connector
+
+import (
+	"crypto/tls"
+	"crypto/x509/pkix"
+	"log"
+	"time"
+)
+
+// Connection attribute set from a verified client certificate, in
+// RFC 2253 form (such as "CN=joel,O=Example")
+const AttrPeerSubject = "peer-subject"
+
+// Clients get this long to complete the TLS handshake before we drop
+// them.
+const tlsHandshakeTimeout = 30 * time.Second
+
+func NewTlsListen(id string, addr string, config *tls.Config) (tcpListen, error) {
+	// This is a normal TCP listener (and hands out normal tcpConn
+	// connections), other than that the listening socket is wrapped
+	// in TLS.  Set config.ClientAuth and config.ClientCAs to have
+	// client certificates verified.
+	listen := tcpListen{}
+
+	l, err := tls.Listen("tcp", addr, config)
+	if err != nil {
+		return listen, err
+	}
+	listen.listener = l
+	listen.Addr = l.Addr()
+	listen.id = id + "-TLS-" + listen.Addr.String()
+	listen.fillDefaults()
+
+	go listen.doListen()
+
+	return listen, nil
+}
+
+func (listen *tcpListen) handshake(conn *tls.Conn) {
+	conn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	err := conn.Handshake()
+	if err != nil {
+		log.Print(err)
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	listen.connectionReady(conn)
+}
+
+func (tcp tcpConn) PeerSubject() (pkix.Name, bool) {
+	// Returns the subject of the certificate the client presented,
+	// but only if it was verified against the listener's ClientCAs.
+	tlsConn, ok := tcp.conn.(*tls.Conn)
+	if !ok {
+		return pkix.Name{}, false
+	}
+
+	state := tlsConn.ConnectionState()
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return pkix.Name{}, false
+	}
+
+	return state.VerifiedChains[0][0].Subject, true
+}
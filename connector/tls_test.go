@@ -0,0 +1,126 @@
+package connector
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testCertificate(t *testing.T, name string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (tls.Certificate, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Equal(t, nil, err, "Key generated")
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign
+	}
+	if parent == nil {
+		parent = template
+		parentKey = key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.Equal(t, nil, err, "Certificate created")
+	cert, err := x509.ParseCertificate(der)
+	assert.Equal(t, nil, err, "Certificate parsed")
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, cert
+}
+
+func TestTlsListen(t *testing.T) {
+	t.Parallel()
+
+	caTls, ca := testCertificate(t, "Test CA", true, nil, nil)
+	caKey := caTls.PrivateKey.(*ecdsa.PrivateKey)
+	serverTls, _ := testCertificate(t, "server", false, ca, caKey)
+	clientTls, _ := testCertificate(t, "joel", false, ca, caKey)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{serverTls},
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		ClientCAs:    pool,
+	}
+	listen, err := NewTlsListen("0", "127.0.0.1:0", config)
+	assert.Equal(t, nil, err, "Listener does not return error")
+
+	addr := listen.Addr.String()
+	assert.Equal(t, "0-TLS-"+addr, listen.Id(), "TLS listener ID correct")
+
+	// With a client certificate
+	outbound, err := tls.Dial("tcp", addr, &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{clientTls},
+	})
+	assert.Equal(t, nil, err, "Error from tls.Dial()")
+
+	m := <-listen.Notify()
+	assert.IsType(t, NewConnectionMessage{}, m, "New connection message")
+	conn := m.(NewConnectionMessage).Conn
+	assert.IsType(t, tcpConn{}, conn, "Connection is a tcpConn")
+
+	subject, ok := conn.(tcpConn).PeerSubject()
+	assert.True(t, ok, "Subject verified")
+	assert.Equal(t, "joel", subject.CommonName, "Subject is correct")
+
+	outbound.Write([]byte("Hello"))
+	m = <-conn.FromConn()
+	assert.Equal(t, "Hello", m.(DataMessage).String())
+
+	conn.ToConn() <- NewDataMessageFromString("Foo")
+	b := make([]byte, 65535)
+	n, err := outbound.Read(b)
+	assert.Equal(t, nil, err, "Outbound read has no error")
+	assert.Equal(t, "Foo", string(b[:n]), "Foo is returned")
+
+	// The subject is still there once the telnet filter is on
+	telnet, err := NewTelnetFilter(conn)
+	assert.Equal(t, nil, err, "No telnet filter error")
+	attributes, ok := ConnectionAttributes(telnet)
+	assert.True(t, ok, "Attributes through telnet filter")
+	value, _ := attributes.Get(AttrPeerSubject)
+	assert.Equal(t, subject.String(), value, "Subject recorded")
+
+	// Our negotiation may not get written before the client goes
+	outbound.Close()
+	for m = range telnet.FromConn() {
+		if m.Type() == MTDisconnectMessage {
+			break
+		}
+	}
+	close(telnet.ToConn())
+
+	// Without a client certificate
+	outbound, err = tls.Dial("tcp", addr, &tls.Config{RootCAs: pool})
+	assert.Equal(t, nil, err, "Error from tls.Dial()")
+
+	m = <-listen.Notify()
+	conn = m.(NewConnectionMessage).Conn
+	_, ok = conn.(tcpConn).PeerSubject()
+	assert.False(t, ok, "No subject without client certificate")
+	_, ok = conn.(tcpConn).Attributes().Get(AttrPeerSubject)
+	assert.False(t, ok, "No subject recorded")
+
+	outbound.Close()
+	close(conn.ToConn())
+}
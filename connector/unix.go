@@ -0,0 +1,159 @@
+package connector
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+)
+
+type UnixListenOptions struct {
+	Mode  os.FileMode // Permissions of the socket file (0 leaves the umask default)
+	User  string      // Owner of the socket file (empty leaves it unchanged)
+	Group string      // Group of the socket file (empty leaves it unchanged)
+}
+
+// Credentials of the process on the other end of a Unix socket
+type PeerCred struct {
+	Pid int
+	Uid int
+	Gid int
+}
+
+// Connection attributes set from the peer credentials, in decimal
+const (
+	AttrPeerPid = "peer-pid"
+	AttrPeerUid = "peer-uid"
+	AttrPeerGid = "peer-gid"
+)
+
+var unixPeerInstance = 0
+var unixPeerMutex sync.Mutex
+
+func nextUnixPeer() string {
+	unixPeerMutex.Lock()
+	defer unixPeerMutex.Unlock()
+
+	unixPeerInstance++
+	return "peer" + strconv.Itoa(unixPeerInstance)
+}
+
+func NewUnixListen(id string, path string, opts UnixListenOptions) (tcpListen, error) {
+	// Connections accepted here are plain tcpConn connections, so
+	// they can be used anywhere a TCP connection could be.
+	listen := tcpListen{}
+
+	err := removeStaleUnixSocket(path)
+	if err != nil {
+		return listen, err
+	}
+
+	l, err := listenUnix(path, opts.Mode)
+	if err != nil {
+		return listen, err
+	}
+
+	err = setUnixSocketPermissions(path, opts)
+	if err != nil {
+		l.Close()
+		return listen, err
+	}
+
+	listen.listener = l
+	listen.Addr = l.Addr()
+	listen.id = id + "-UNIX-" + path
+	listen.fillDefaults()
+
+	go listen.doListen()
+
+	return listen, nil
+}
+
+func NewUnixDial(id string, path string) (tcpConn, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return tcpConn{}, err
+	}
+
+	c := newTcpConn(id+"-UNIX-"+path, conn)
+	go c.connectionInputHandler()
+	go c.connectionOutputHandler()
+
+	return c, nil
+}
+
+func unixSocketAnswers(path string) bool {
+	// A listener sees this as a connection, so we only do it when
+	// there's no other way to tell
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+func removeStaleUnixSocket(path string) error {
+	// A socket file left behind by a process that died would stop
+	// us from listening.  We only remove it if it really is a
+	// socket and nobody is answering on it.
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return errors.New(path + " exists and is not a socket")
+	}
+
+	listening, err := unixSocketListening(path)
+	if err != nil {
+		return err
+	}
+	if listening {
+		return errors.New(path + " is in use by another process")
+	}
+
+	return os.Remove(path)
+}
+
+func setUnixSocketPermissions(path string, opts UnixListenOptions) error {
+	if opts.Mode != 0 {
+		err := os.Chmod(path, opts.Mode)
+		if err != nil {
+			return err
+		}
+	}
+
+	uid := -1
+	gid := -1
+	if opts.User != "" {
+		u, err := user.Lookup(opts.User)
+		if err != nil {
+			return err
+		}
+		uid, err = strconv.Atoi(u.Uid)
+		if err != nil {
+			return err
+		}
+	}
+	if opts.Group != "" {
+		g, err := user.LookupGroup(opts.Group)
+		if err != nil {
+			return err
+		}
+		gid, err = strconv.Atoi(g.Gid)
+		if err != nil {
+			return err
+		}
+	}
+	if uid == -1 && gid == -1 {
+		return nil
+	}
+
+	return os.Chown(path, uid, gid)
+}
@@ -0,0 +1,102 @@
+package connector
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	// The socket file gets its permissions from the socket when it
+	// is bound, less the umask, so we narrow them first rather than
+	// leave it open to anyone until we get to chmod it.
+	config := net.ListenConfig{}
+	if mode != 0 {
+		config.Control = func(network, address string, raw syscall.RawConn) error {
+			var chmodErr error
+			err := raw.Control(func(fd uintptr) {
+				chmodErr = unix.Fchmod(int(fd), uint32(mode.Perm()))
+			})
+			if err != nil {
+				return err
+			}
+			return chmodErr
+		}
+	}
+	return config.Listen(context.Background(), "unix", path)
+}
+
+func unixSocketListening(path string) (bool, error) {
+	// The kernel lists every bound socket with its path, so we can
+	// tell if one is live without connecting to it.  Paths are as
+	// the binding process gave them, so a relative one with the same
+	// name might be ours too, which only connecting can tell us.
+	f, err := os.Open("/proc/net/unix")
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+
+	ambiguous := false
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // Header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 {
+			continue
+		}
+		bound := strings.Join(fields[7:], " ")
+		if bound == abs {
+			return true, nil
+		}
+		if !filepath.IsAbs(bound) && filepath.Base(bound) == filepath.Base(path) {
+			ambiguous = true
+		}
+	}
+	if scanner.Err() != nil {
+		return false, scanner.Err()
+	}
+
+	if ambiguous {
+		return unixSocketAnswers(path), nil
+	}
+	return false, nil
+}
+
+func (tcp tcpConn) PeerCred() (PeerCred, error) {
+	unixConn, ok := tcp.conn.(*net.UnixConn)
+	if !ok {
+		return PeerCred{}, errors.New("not a unix socket connection")
+	}
+
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return PeerCred{}, err
+	}
+
+	var ucred *unix.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		ucred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil {
+		return PeerCred{}, err
+	}
+	if credErr != nil {
+		return PeerCred{}, credErr
+	}
+
+	return PeerCred{Pid: int(ucred.Pid), Uid: int(ucred.Uid), Gid: int(ucred.Gid)}, nil
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package connector
+
+import (
+	"errors"
+	"net"
+	"os"
+)
+
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
+
+func unixSocketListening(path string) (bool, error) {
+	// Without a list of bound sockets, the only way to tell is to
+	// connect
+	return unixSocketAnswers(path), nil
+}
+
+func (tcp tcpConn) PeerCred() (PeerCred, error) {
+	return PeerCred{}, errors.New("peer credentials are not supported on this platform")
+}
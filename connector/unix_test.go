@@ -0,0 +1,110 @@
+package connector
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnixListen(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "termnet.sock")
+
+	// Leave a stale socket behind, like a crashed process would.
+	stale, err := net.Listen("unix", path)
+	assert.Equal(t, nil, err, "Stale listener created")
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listen, err := NewUnixListen("0", path, UnixListenOptions{Mode: 0660})
+	assert.Equal(t, nil, err, "Listener does not return error")
+	assert.Equal(t, "0-UNIX-"+path, listen.Id(), "Unix listener ID correct")
+
+	info, err := os.Stat(path)
+	assert.Equal(t, nil, err, "Socket exists")
+	assert.Equal(t, os.FileMode(0660), info.Mode().Perm(), "Socket mode set")
+
+	dial, err := NewUnixDial("1", path)
+	assert.Equal(t, nil, err, "Dial does not return error")
+	assert.Equal(t, "1-UNIX-"+path, dial.Id(), "Unix dial ID correct")
+
+	m := <-listen.Notify()
+	assert.IsType(t, NewConnectionMessage{}, m, "New connection message")
+	conn := m.(NewConnectionMessage).Conn
+	assert.IsType(t, tcpConn{}, conn, "Connection is a tcpConn")
+	assert.Regexp(t, "^0-UNIX-.*-peer[0-9]+$", conn.Id(), "Connection ID correct")
+
+	cred, err := conn.(tcpConn).PeerCred()
+	assert.Equal(t, nil, err, "Peer credentials available")
+	assert.Equal(t, os.Getpid(), cred.Pid, "Peer PID correct")
+	assert.Equal(t, os.Getuid(), cred.Uid, "Peer UID correct")
+	assert.Equal(t, os.Getgid(), cred.Gid, "Peer GID correct")
+	value, _ := conn.(tcpConn).Attributes().Get(AttrPeerUid)
+	assert.Equal(t, strconv.Itoa(os.Getuid()), value, "Peer UID recorded")
+
+	dial.ToConn() <- NewDataMessageFromString("Hello")
+	m = <-conn.FromConn()
+	assert.Equal(t, "Hello", m.(DataMessage).String(), "Data from dialer")
+
+	conn.ToConn() <- NewDataMessageFromString("Foo")
+	m = <-dial.FromConn()
+	assert.Equal(t, "Foo", m.(DataMessage).String(), "Data from listener")
+
+	close(dial.ToConn())
+	m = <-conn.FromConn()
+	assert.IsType(t, DisconnectMessage{}, m, "Disconnect received")
+	close(conn.ToConn())
+
+	_, err = NewUnixListen("0", path, UnixListenOptions{})
+	assert.NotEqual(t, nil, err, "Socket in use is not removed")
+	select {
+	case m = <-listen.Notify():
+		t.Errorf("Checking the socket made a connection: %s", m.TypeString())
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestUnixListenRelativeName(t *testing.T) {
+	t.Parallel()
+
+	// A live socket bound under a relative path with the same name
+	// as a stale one elsewhere
+	name := "termnet-" + strconv.Itoa(os.Getpid()) + ".sock"
+	live, err := net.Listen("unix", name)
+	assert.Equal(t, nil, err, "Relative listener created")
+	defer live.Close()
+
+	path := filepath.Join(t.TempDir(), name)
+	stale, err := net.Listen("unix", path)
+	assert.Equal(t, nil, err, "Stale listener created")
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listen, err := NewUnixListen("0", path, UnixListenOptions{})
+	if !assert.Equal(t, nil, err, "Stale socket removed") {
+		return
+	}
+	listen.Control() <- CloseListenerMessage{}
+	<-listen.Notify()
+
+	_, err = os.Stat(path)
+	assert.True(t, errors.Is(err, os.ErrNotExist), "Socket removed on close")
+}
+
+func TestUnixListenNotSocket(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "file")
+	err := os.WriteFile(path, []byte("data"), 0600)
+	assert.Equal(t, nil, err, "File written")
+
+	_, err = NewUnixListen("0", path, UnixListenOptions{})
+	assert.NotEqual(t, nil, err, "Regular file is not removed")
+}
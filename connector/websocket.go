@@ -0,0 +1,197 @@
+package connector
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
+
+//go:embed websocket-terminal.html
+var websocketTerminalPage []byte
+
+type websocketListen struct {
+	listenControl
+	upgrader websocket.Upgrader
+	handed   *connListener // Where the HTTP server gets connections from us
+	Addr     net.Addr
+}
+
+func (listen websocketListen) Id() string            { return listen.id }
+func (listen websocketListen) Control() chan message { return listen.control }
+func (listen websocketListen) Notify() chan message  { return listen.notify }
+
+type websocketConn struct {
+	id       string
+	ws       *websocket.Conn
+	fromConn chan message
+	toConn   chan message
+}
+
+func (c websocketConn) Id() string             { return c.id }
+func (c websocketConn) FromConn() chan message { return c.fromConn }
+func (c websocketConn) ToConn() chan message   { return c.toConn }
+func (c websocketConn) RemoteAddr() net.Addr   { return c.ws.RemoteAddr() }
+
+// Terminal data travels in binary frames.  Text frames carry JSON
+// control messages from the browser, such as:
+//
+//	{"type": "resize", "cols": 80, "rows": 24}
+type websocketControl struct {
+	Type string `json:"type"`
+	Cols int    `json:"cols"`
+	Rows int    `json:"rows"`
+}
+
+func NewWebsocketListen(id string, addr string) (websocketListen, error) {
+	listen := websocketListen{}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return listen, err
+	}
+	listen.listener = l
+	listen.Addr = l.Addr()
+	listen.id = id + "-WS-" + listen.Addr.String()
+	listen.fillControlDefaults()
+	listen.handed = newConnListener(listen.Addr)
+
+	go listen.serve(listen.handed)
+	go listen.doListen()
+
+	return listen, nil
+}
+
+func (listen *websocketListen) doListen() {
+	// We accept connections ourselves, so that control messages
+	// work as they do for other listeners, and pass them on to the
+	// HTTP server.
+	defer listen.listener.Close()
+	defer listen.handed.Close()
+	listen.acceptLoop(listen.dispatch, nil)
+}
+
+func (listen *websocketListen) dispatch(conn net.Conn) {
+	if listen.overLimit(conn) {
+		return
+	}
+	listen.handed.hand(listen.track(conn))
+}
+
+func (listen *websocketListen) serve(l net.Listener) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", listen.serveTerminalPage)
+	mux.HandleFunc("/ws", listen.serveWebsocket)
+
+	return http.Serve(l, mux)
+}
+
+func (listen *websocketListen) serveTerminalPage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	// Everything the page needs is in it, so it has no business
+	// loading or sending anything anywhere else.
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; script-src 'unsafe-inline'; style-src 'unsafe-inline'; connect-src 'self'")
+	w.Write(websocketTerminalPage)
+}
+
+func (listen *websocketListen) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	ws, err := listen.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader already sent the client an error
+		log.Print(err)
+		return
+	}
+
+	c := websocketConn{}
+	c.ws = ws
+	c.id = listen.id + "-" + ws.RemoteAddr().String()
+	c.fromConn = make(chan message)
+	c.toConn = make(chan message)
+
+	msg := NewConnectionMessage{}
+	msg.Conn = c
+	listen.notify <- msg
+
+	go c.connectionInputHandler()
+	go c.connectionOutputHandler()
+}
+
+func (c *websocketConn) connectionOutputHandler() {
+	defer close(c.fromConn)
+
+	for {
+		frameType, b, err := c.ws.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			if errors.As(err, &closeErr) {
+				c.fromConn <- DisconnectMessage{}
+			} else {
+				c.fromConn <- ErrorMessage{Err: err}
+			}
+			return
+		}
+
+		switch frameType {
+		case websocket.BinaryMessage:
+			if len(b) > 0 {
+				c.fromConn <- DataMessage{Data: b}
+			}
+		case websocket.TextMessage:
+			control := websocketControl{}
+			err := json.Unmarshal(b, &control)
+			if err != nil {
+				log.Print("Invalid control message from browser: " + err.Error())
+				continue
+			}
+			if control.Type == "resize" {
+				c.fromConn <- WindowSizeMessage{Width: control.Cols, Height: control.Rows}
+			} else {
+				log.Print("Unknown control message from browser: " + control.Type)
+			}
+		}
+	}
+}
+
+func (c *websocketConn) connectionInputHandler() {
+	// If writing fails our user finds out from the output handler,
+	// and we don't want them stuck sending to us until then.
+	failed := false
+	defer func() {
+		if failed {
+			drainMessages(c.toConn)
+		}
+	}()
+	defer c.ws.Close()
+	for {
+		m, ok := <-c.toConn
+		if !ok {
+			return
+		}
+
+		switch m.(type) {
+		case DataMessage:
+			dataMsg := m.(DataMessage)
+			err := c.ws.WriteMessage(websocket.BinaryMessage, dataMsg.Data)
+			if err != nil {
+				log.Print("Could not write message to websocket")
+				failed = true
+				return
+			}
+		case DisconnectMessage:
+			c.ws.WriteMessage(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return
+		default:
+			log.Print("Unknown message type: " + m.TypeString())
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package connector
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebsocketListen(t *testing.T) {
+	t.Parallel()
+
+	listen, err := NewWebsocketListen("0", "127.0.0.1:0")
+	assert.Equal(t, nil, err, "Listener does not return error")
+
+	addr := listen.Addr.String()
+	assert.Equal(t, "0-WS-"+addr, listen.Id(), "Websocket listener ID correct")
+
+	resp, err := http.Get("http://" + addr + "/")
+	assert.Equal(t, nil, err, "Terminal page fetched")
+	page, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, nil, err, "Terminal page read")
+	assert.Contains(t, string(page), "new WebSocket(", "Terminal page served")
+	assert.NotRegexp(t, `<(script|link|img)[^>]* (src|href)=`, string(page), "Terminal page loads nothing from elsewhere")
+	assert.Contains(t, resp.Header.Get("Content-Security-Policy"), "default-src 'none'", "Terminal page locked down")
+
+	resp, err = http.Get("http://" + addr + "/nothing")
+	assert.Equal(t, nil, err, "Missing page fetched")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "Missing page not found")
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws://"+addr+"/ws", nil)
+	assert.Equal(t, nil, err, "Websocket dial does not return error")
+
+	m := <-listen.Notify()
+	assert.IsType(t, NewConnectionMessage{}, m, "New connection message")
+	conn := m.(NewConnectionMessage).Conn
+	assert.IsType(t, websocketConn{}, conn, "Connection is a websocket")
+
+	ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"resize","cols":132,"rows":50}`))
+	m = <-conn.FromConn()
+	assert.Equal(t, WindowSizeMessage{Width: 132, Height: 50}, m, "Resize received")
+
+	ws.WriteMessage(websocket.BinaryMessage, []byte("Hello"))
+	m = <-conn.FromConn()
+	assert.Equal(t, "Hello", m.(DataMessage).String(), "Data received")
+
+	conn.ToConn() <- NewDataMessageFromString("Foo")
+	frameType, b, err := ws.ReadMessage()
+	assert.Equal(t, nil, err, "Websocket read has no error")
+	assert.Equal(t, websocket.BinaryMessage, frameType, "Binary frame sent")
+	assert.Equal(t, "Foo", string(b), "Foo is returned")
+
+	ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	m = <-conn.FromConn()
+	assert.IsType(t, DisconnectMessage{}, m, "Disconnect received")
+
+	_, ok := <-conn.FromConn()
+	assert.False(t, ok, "Channel closed")
+
+	// The close was answered, so nothing more can be written
+	for i := 0; i < 2; i++ {
+		select {
+		case conn.ToConn() <- NewDataMessageFromString("Bar"):
+		case <-time.After(time.Second):
+			t.Fatal("Send blocked after write failure")
+		}
+	}
+	close(conn.ToConn())
+	ws.Close()
+}
@@ -2,9 +2,17 @@ module github.com/jmaslak/termnet2
 
 go 1.20
 
+require (
+	github.com/creack/pty v1.1.21
+	github.com/gorilla/websocket v1.5.3
+	github.com/stretchr/testify v1.8.4
+	golang.org/x/crypto v0.17.0
+	golang.org/x/sys v0.15.0
+	golang.org/x/term v0.15.0
+)
+
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/stretchr/testify v1.8.4 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
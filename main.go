@@ -1,37 +1,90 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/jmaslak/termnet2/connector"
 )
 
 func main() {
+	console := flag.Bool("console", false, "Also serve a user on this terminal (^] to quit)")
+	flag.Parse()
+
+	// Errors come back here rather than being fatal where they
+	// happen, so that the console's terminal is restored first.
+	err := run(*console)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(console bool) error {
 	nodeId := "0"
 	fmt.Println("Starting...")
 	listen, err := connector.NewTcpListen(nodeId, ":2222")
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+
+	// In raw mode ^C doesn't make a signal, but we may still get one
+	// from elsewhere.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	var consoleDone chan struct{}
+	if console {
+		stdio, err := connector.NewStdioConnection(nodeId)
+		if err != nil {
+			return err
+		}
+		defer stdio.Restore()
+		consoleDone = stdio.Done()
+
+		filteredConn, err := connector.NewNewlineOutFilter(stdio)
+		if err != nil {
+			return err
+		}
+		connector.StartLoopApp(filteredConn)
 	}
 
 	for {
-		m := <-listen.Notify()
-		switch m.(type) {
-		case connector.NewConnectionMessage:
-			msg := m.(connector.NewConnectionMessage)
-			fmt.Println("New connection!")
-			telnetConn, err := connector.NewTelnetFilter(msg.Conn)
-			if err != nil {
-				log.Fatal(err)
-			}
-			filteredConn, err := connector.NewNewlineOutFilter(telnetConn)
-			if err != nil {
-				log.Fatal(err)
+		select {
+		case <-consoleDone:
+			// The console user quit
+			return nil
+		case sig := <-signals:
+			log.Print("Exiting on " + sig.String())
+			return nil
+		case m := <-listen.Notify():
+			switch m.(type) {
+			case connector.NewConnectionMessage:
+				msg := m.(connector.NewConnectionMessage)
+				fmt.Println("New connection!")
+				telnetConn, err := connector.NewTelnetFilter(msg.Conn)
+				if err != nil {
+					return err
+				}
+				filteredConn, err := connector.NewNewlineOutFilter(telnetConn)
+				if err != nil {
+					return err
+				}
+				connector.StartLoopApp(filteredConn)
+			case connector.ErrorMessage:
+				log.Print(m.(connector.ErrorMessage).Err)
+			case connector.ListenerStatusMessage:
+				if m.(connector.ListenerStatusMessage).Closed {
+					return errors.New("listener closed")
+				}
+			default:
+				log.Print("Unknown message type: " + m.TypeString())
 			}
-			connector.StartLoopApp(filteredConn)
-		default:
-			log.Fatal("Unknown message type: " + m.TypeString())
 		}
 	}
 }